@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"sdh-agent/internal/github"
+	"sdh-agent/internal/llm"
+)
+
+// runAnalyze analyzes a single SDH issue and optionally posts the report on it
+func runAnalyze(args []string) {
+	// Parse command line flags
+	flags := newFlagSet("analyze", "[flags] <issue-number | owner/repo#number | issue-url>")
+	var common commonFlags
+	common.register(flags)
+	post := flags.Bool("post", false, "Post the generated report as a comment on the issue")
+	dryRun := flags.Bool("dry-run", true, "Print the comment that would be posted without publishing it")
+	output := flags.String("output", "", "Write the report to this file instead of stdout")
+	format := flags.String("format", formatMarkdown, "Report format: markdown or json")
+	timeout := flags.Duration("timeout", 0, "Abort the run after this duration (e.g. 10m); 0 means no timeout")
+	stream := flags.Bool("stream", true, "Render the report as it is generated when printing it to a terminal")
+	flags.Parse(args)
+
+	// --post disables the dry-run default unless --dry-run was passed explicitly
+	if *post && !isFlagSet(flags, "dry-run") {
+		*dryRun = false
+	}
+	publish := *post && !*dryRun
+
+	if err := validateFormat(*format); err != nil {
+		fatalf("%v", err)
+	}
+
+	// Get the issue from command line arguments
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ref, err := github.ParseIssueReference(flags.Arg(0))
+	if err != nil {
+		fatalf("%v", err)
+	}
+	issueNumber := ref.Number
+
+	// An issue of another repository takes precedence over the configured one and --repo
+	if ref.HasRepo() {
+		common.repo = ref.Owner + "/" + ref.Repo
+	}
+
+	// Initialize and run the agent
+	cfg, sdhAgent := common.newAgent()
+	defer sdhAgent.Close()
+
+	ctx, cancel := newRunContext(*timeout)
+	defer cancel()
+
+	// Issue URLs must point to the GitHub instance the client is configured for
+	if ref.Host != "" && !strings.EqualFold(ref.Host, cfg.GitHubHost()) {
+		fatalf("Issue %s is on %s but the agent is configured for %s (see GITHUB_BASE_URL)", ref, ref.Host, cfg.GitHubHost())
+	}
+
+	target := fmt.Sprintf("%s/%s#%d", cfg.GitHubRepoOwner, cfg.GitHubRepoName, issueNumber)
+	if ref.Host != "" {
+		target = ref.Host + "/" + target
+	}
+
+	log.Printf("▶️  Starting analysis for issue: %s\n", target)
+	// Meter the LLM usage to print its totals at the end
+	meter := &llm.UsageMeter{}
+
+	// Render the report text as it is generated when it is printed to a terminal, as the
+	// report generation can take a while. The full report is still collected for posting.
+	var onReportText func(text string)
+	streamed := false
+	if *stream && *output == "" && *format == formatMarkdown && isTerminal(os.Stdout) {
+		onReportText = func(text string) {
+			if !streamed {
+				log.Println("===== REPORT BEGIN =====")
+				streamed = true
+			}
+			os.Stdout.WriteString(text)
+		}
+	}
+
+	report, err := sdhAgent.ProcessIssueStreaming(llm.WithUsageMeter(ctx, meter), issueNumber, onReportText)
+	if streamed {
+		fmt.Println()
+		log.Println("===== REPORT END =====")
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			fatalf("Processing aborted: %v", interruptCause(ctx))
+		}
+		fatalf("An error occurred during processing: %v", err)
+	}
+
+	log.Println("✅ Successfully processed issue and generated report")
+
+	// Build the comment, reusing the previous report comment if there is one
+	comment, err := sdhAgent.PrepareReportComment(ctx, issueNumber, report)
+	if err != nil {
+		fatalf("Failed to prepare report comment: %v", err)
+	}
+
+	if !publish {
+		if streamed {
+			// The report was already rendered, without the header, footer and revision history of the comment
+			log.Printf("🔎 Dry run: the report above would be posted to %s", target)
+		} else if comment.CommentID != 0 {
+			log.Printf("🔎 Dry run: the following comment would replace comment %d on %s", comment.CommentID, target)
+		} else {
+			log.Printf("🔎 Dry run: the following comment would be posted to %s", target)
+		}
+	}
+
+	// Publish the report on the issue, still writing it out if that fails
+	var publishErr error
+	if publish {
+		publishErr = sdhAgent.PublishReport(ctx, comment)
+	}
+
+	// A streamed report was already printed
+	if !streamed {
+		if *output == "" {
+			log.Println("===== REPORT BEGIN =====")
+		}
+		if err := writeReport(*output, *format, cfg, comment, publish && publishErr == nil); err != nil {
+			fatalf("%v", err)
+		}
+		if *output == "" {
+			log.Println("===== REPORT END =====")
+		} else {
+			log.Printf("📄 Report written to %s", *output)
+		}
+	}
+
+	log.Printf("💰 %s", meter.Total())
+
+	if publishErr != nil {
+		fatalf("Failed to post report: %v", publishErr)
+	}
+
+	if !publish {
+		log.Println("ℹ️  Re-run with --post to publish the report")
+		return
+	}
+	log.Printf("📝 Report posted to %s", target)
+}
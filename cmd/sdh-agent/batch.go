@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"sdh-agent/internal/llm"
+	"sdh-agent/pkg/utils"
+)
+
+// batchResult is the outcome of the analysis of one issue of a batch
+type batchResult struct {
+	IssueNumber int
+	ReportPath  string
+	Err         error
+	Duration    time.Duration
+	Usage       llm.Usage
+}
+
+// runBatch analyzes many issues, selected by a search query or by number, and writes one report per issue
+func runBatch(args []string) {
+	flags := newFlagSet("batch", "[flags] <--query <query> | <issue-number|first-last>...>")
+	var common commonFlags
+	common.register(flags)
+	query := flags.String("query", "", `GitHub search query selecting the issues (e.g. "label:SDH is:open no:assignee")`)
+	limit := flags.Int("limit", 100, "Maximum number of issues selected by --query")
+	outputDir := flags.String("output-dir", "reports", "Directory the reports are written to")
+	format := flags.String("format", formatMarkdown, "Report format: markdown or json")
+	post := flags.Bool("post", false, "Post each report as a comment on its issue")
+	dryRun := flags.Bool("dry-run", true, "Only write the reports without publishing them")
+	concurrency := flags.Int("concurrency", 2, "Number of issues analyzed in parallel")
+	timeout := flags.Duration("timeout", 0, "Abort the batch after this duration (e.g. 2h); 0 means no timeout")
+	flags.Parse(args)
+
+	// --post disables the dry-run default unless --dry-run was passed explicitly
+	if *post && !isFlagSet(flags, "dry-run") {
+		*dryRun = false
+	}
+	publish := *post && !*dryRun
+
+	if (*query == "") == (flags.NArg() == 0) || *limit < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if err := validateFormat(*format); err != nil {
+		fatalf("%v", err)
+	}
+
+	issueNumbers, err := parseIssueNumbers(flags.Args())
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	cfg, sdhAgent := common.newAgent()
+	defer sdhAgent.Close()
+
+	ctx, cancel := newRunContext(*timeout)
+	defer cancel()
+
+	// Resolve the issues matching the query
+	if *query != "" {
+		log.Printf("🔎 Searching issues of %s/%s matching '%s'", cfg.GitHubRepoOwner, cfg.GitHubRepoName, *query)
+		if issueNumbers, err = sdhAgent.FindIssueNumbers(ctx, *query, *limit); err != nil {
+			fatalf("Failed to search issues: %v", err)
+		}
+	}
+	if len(issueNumbers) == 0 {
+		log.Println("No issues to analyze")
+		return
+	}
+
+	if err := os.MkdirAll(*outputDir, 0o755); err != nil {
+		fatalf("Failed to create output directory: %v", err)
+	}
+
+	extension := "md"
+	if *format == formatJSON {
+		extension = "json"
+	}
+
+	log.Printf("▶️  Analyzing %d issues with concurrency %d", len(issueNumbers), *concurrency)
+	results := utils.ParallelMap(issueNumbers, *concurrency, func(issueNumber int) batchResult {
+		result := batchResult{IssueNumber: issueNumber}
+		start := time.Now()
+
+		// Meter the LLM usage of this issue only
+		meter := &llm.UsageMeter{}
+		report, err := sdhAgent.ProcessIssue(llm.WithUsageMeter(ctx, meter), issueNumber)
+		result.Duration = time.Since(start)
+		result.Usage = meter.Total()
+		if err != nil {
+			log.Printf("❌ Failed to analyze issue #%d: %v", issueNumber, err)
+			result.Err = err
+			return result
+		}
+
+		comment, err := sdhAgent.PrepareReportComment(ctx, issueNumber, report)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+
+		if publish {
+			if err := sdhAgent.PublishReport(ctx, comment); err != nil {
+				result.Err = err
+			}
+		}
+
+		path := filepath.Join(*outputDir, fmt.Sprintf("issue-%d.%s", issueNumber, extension))
+		if err := writeReport(path, *format, cfg, comment, publish && result.Err == nil); err != nil {
+			result.Err = errors.Join(result.Err, err)
+			return result
+		}
+		result.ReportPath = path
+		return result
+	})
+
+	failed := printBatchSummary(results)
+	logRateBudgets(sdhAgent.GitHubClient())
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// printBatchSummary prints a table of the batch results and returns the number of failed issues
+func printBatchSummary(results []batchResult) int {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ISSUE\tSTATUS\tDURATION\tLLM CALLS\tINPUT TOKENS\tOUTPUT TOKENS\tCACHE READ/WRITE\tCOST\tREPORT / ERROR")
+
+	var total llm.Usage
+	failed := 0
+	for _, result := range results {
+		status, detail := "ok", result.ReportPath
+		if result.Err != nil {
+			status, detail = "failed", result.Err.Error()
+			failed++
+		}
+		total = total.Add(result.Usage)
+
+		fmt.Fprintf(writer, "#%d\t%s\t%s\t%d\t%d\t%d\t%d/%d\t$%.4f\t%s\n", result.IssueNumber, status, result.Duration.Round(time.Second),
+			result.Usage.Calls, result.Usage.InputTokens, result.Usage.OutputTokens,
+			result.Usage.CacheReadTokens, result.Usage.CacheWriteTokens, result.Usage.Cost, detail)
+	}
+
+	fmt.Fprintf(writer, "TOTAL\t%d ok, %d failed\t\t%d\t%d\t%d\t%d/%d\t$%.4f\t\n", len(results)-failed, failed,
+		total.Calls, total.InputTokens, total.OutputTokens, total.CacheReadTokens, total.CacheWriteTokens, total.Cost)
+	writer.Flush()
+
+	return failed
+}
+
+// parseIssueNumbers parses issue numbers given as "123", "120-130" or comma-separated lists of those
+func parseIssueNumbers(args []string) ([]int, error) {
+	var numbers []int
+	seen := make(map[int]bool)
+
+	for _, arg := range args {
+		for _, item := range strings.Split(arg, ",") {
+			item = strings.TrimSpace(strings.TrimPrefix(item, "#"))
+			if item == "" {
+				continue
+			}
+
+			first, last, isRange := strings.Cut(item, "-")
+			from, err := strconv.Atoi(first)
+			if err != nil {
+				return nil, fmt.Errorf("invalid issue number %q", item)
+			}
+			to := from
+			if isRange {
+				if to, err = strconv.Atoi(last); err != nil || to < from {
+					return nil, fmt.Errorf("invalid issue range %q", item)
+				}
+			}
+
+			for number := from; number <= to; number++ {
+				if !seen[number] {
+					seen[number] = true
+					numbers = append(numbers, number)
+				}
+			}
+		}
+	}
+
+	return numbers, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestParseIssueNumbers checks the parsing of issue numbers, ranges and comma-separated lists
+func TestParseIssueNumbers(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    []int
+		wantErr bool
+	}{
+		{name: "single issue", args: []string{"123"}, want: []int{123}},
+		{name: "hash prefix", args: []string{"#123"}, want: []int{123}},
+		{name: "several arguments", args: []string{"3", "1", "2"}, want: []int{3, 1, 2}},
+		{name: "range", args: []string{"120-123"}, want: []int{120, 121, 122, 123}},
+		{name: "single issue range", args: []string{"7-7"}, want: []int{7}},
+		{name: "comma-separated list", args: []string{"1,#5, 9"}, want: []int{1, 5, 9}},
+		{name: "list of ranges", args: []string{"1-2,10-11"}, want: []int{1, 2, 10, 11}},
+		{name: "duplicates are dropped", args: []string{"1-3", "2,3,4"}, want: []int{1, 2, 3, 4}},
+		{name: "empty items are skipped", args: []string{"1,,2,"}, want: []int{1, 2}},
+		{name: "no arguments", args: nil, want: nil},
+		{name: "reversed range", args: []string{"130-120"}, wantErr: true},
+		{name: "open range", args: []string{"120-"}, wantErr: true},
+		{name: "negative number", args: []string{"-5"}, wantErr: true},
+		{name: "junk", args: []string{"abc"}, wantErr: true},
+		{name: "junk in a list", args: []string{"1,two,3"}, wantErr: true},
+		{name: "junk range end", args: []string{"1-x"}, wantErr: true},
+		{name: "issue URL", args: []string{"https://github.com/acme/sdh/issues/1"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseIssueNumbers(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseIssueNumbers(%q) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseIssueNumbers(%q) = %v, want %v", tt.args, got, tt.want)
+			}
+		})
+	}
+}
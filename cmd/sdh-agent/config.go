@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"sdh-agent/internal/config"
+)
+
+// runConfig dispatches the config subcommands
+func runConfig(args []string) {
+	if len(args) < 1 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "Usage: sdh-agent config check [flags]")
+		os.Exit(2)
+	}
+
+	runConfigCheck(args[1:])
+}
+
+// runConfigCheck validates the configuration, prints the effective settings and optionally checks GitHub access
+func runConfigCheck(args []string) {
+	flags := newFlagSet("config check", "[flags]")
+	var common commonFlags
+	common.register(flags)
+	online := flags.Bool("online", false, "Also check that the GitHub repository can be accessed")
+	flags.Parse(args)
+
+	cfg, sdhAgent := common.newAgent()
+	defer sdhAgent.Close()
+
+	printConfig(cfg)
+
+	if *online {
+		ctx, cancel := newRunContext(30 * time.Second)
+		defer cancel()
+
+		if err := sdhAgent.CheckGitHubAccess(ctx); err != nil {
+			fatalf("%v", err)
+		}
+		log.Printf("✅ Repository %s/%s is accessible", cfg.GitHubRepoOwner, cfg.GitHubRepoName)
+		logRateBudgets(sdhAgent.GitHubClient())
+	}
+
+	log.Println("✅ Configuration is valid")
+}
+
+// printConfig prints the effective configuration with secrets masked
+func printConfig(cfg *config.Configuration) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	row := func(name string, value any) {
+		fmt.Fprintf(writer, "%s\t%v\n", name, value)
+	}
+
+	row("Repository", cfg.GitHubRepoOwner+"/"+cfg.GitHubRepoName)
+	row("GitHub host", cfg.GitHubHost())
+	if cfg.UsesGitHubApp() {
+		row("GitHub App", fmt.Sprintf("app %d, installation %d", cfg.GitHubAppID, cfg.GitHubAppInstallationID))
+		row("GitHub App private key", "(set)")
+	} else {
+		row("GitHub token", maskSecret(cfg.GitHubToken))
+	}
+	row("LLM provider", cfg.LlmProvider)
+	row("LLM API key", maskSecret(cfg.LlmApiKey))
+	if cfg.LlmBaseURL != "" {
+		row("LLM base URL", cfg.LlmBaseURL)
+	}
+	for _, stage := range config.Stages {
+		row(fmt.Sprintf("LLM %s stage", stage), formatSettings(cfg.StageSettings(stage)))
+	}
+	row("Run budget", formatBudget(cfg))
+	row("Concurrency", cfg.Concurrency)
+	row("Retrieval mode", cfg.RetrievalMode)
+	row("Index", cfg.IndexPath)
+	if cfg.IndexQuery != "" {
+		row("Index query", cfg.IndexQuery)
+	}
+	if cfg.CacheDisabled {
+		row("Cache", "disabled")
+	} else {
+		row("Cache", cfg.CachePath)
+	}
+	row("Job queue", cfg.QueuePath)
+	row("Webhook secret", maskSecret(cfg.WebhookSecret))
+	if len(cfg.WebhookLabels) > 0 {
+		row("Webhook labels", strings.Join(cfg.WebhookLabels, ", "))
+	}
+
+	writer.Flush()
+}
+
+// formatSettings describes LLM settings, showing provider defaults as "default"
+func formatSettings(settings config.LlmSettings) string {
+	model, maxTokens, temperature := "default", "default", "default"
+	if settings.Model != "" {
+		model = settings.Model
+	}
+	if settings.MaxTokens != 0 {
+		maxTokens = fmt.Sprint(settings.MaxTokens)
+	}
+	if settings.Temperature != nil {
+		temperature = fmt.Sprint(*settings.Temperature)
+	}
+	return fmt.Sprintf("model=%s max_tokens=%s temperature=%s", model, maxTokens, temperature)
+}
+
+// formatBudget describes the LLM budget of a run
+func formatBudget(cfg *config.Configuration) string {
+	var limits []string
+	if cfg.MaxRunCost > 0 {
+		limits = append(limits, fmt.Sprintf("$%.2f", cfg.MaxRunCost))
+	}
+	if cfg.MaxRunTokens > 0 {
+		limits = append(limits, fmt.Sprintf("%d tokens", cfg.MaxRunTokens))
+	}
+	if len(limits) == 0 {
+		return "unlimited"
+	}
+	return strings.Join(limits, ", ")
+}
+
+// maskSecret hides all but the last characters of a secret
+func maskSecret(secret string) string {
+	switch {
+	case secret == "":
+		return "(not set)"
+	case len(secret) <= 8:
+		return "****"
+	default:
+		return "****" + secret[len(secret)-4:]
+	}
+}
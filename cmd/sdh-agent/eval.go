@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"sdh-agent/pkg/utils"
+)
+
+// evalCase is an issue along with the issues known to be related to it
+type evalCase struct {
+	IssueNumber int   `json:"issue"`
+	Expected    []int `json:"expected"`
+}
+
+// evalResult is the outcome of the evaluation of one case
+type evalResult struct {
+	evalCase
+	Found []int
+	Hits  int
+	Err   error
+}
+
+// runEval measures how well the retrieval and relevance steps find issues known to be related
+func runEval(args []string) {
+	flags := newFlagSet("eval", "[flags] --cases <file>")
+	var common commonFlags
+	common.register(flags)
+	casesPath := flags.String("cases", "", `JSON file listing cases as [{"issue": 123, "expected": [45, 67]}, ...]`)
+	concurrency := flags.Int("concurrency", 1, "Number of cases evaluated in parallel")
+	timeout := flags.Duration("timeout", 0, "Abort the evaluation after this duration (e.g. 1h); 0 means no timeout")
+	flags.Parse(args)
+
+	if *casesPath == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(*casesPath)
+	if err != nil {
+		fatalf("Failed to read cases: %v", err)
+	}
+	var cases []evalCase
+	if err := json.Unmarshal(data, &cases); err != nil {
+		fatalf("Failed to parse cases: %v", err)
+	}
+
+	_, sdhAgent := common.newAgent()
+	defer sdhAgent.Close()
+
+	ctx, cancel := newRunContext(*timeout)
+	defer cancel()
+
+	log.Printf("▶️  Evaluating %d cases", len(cases))
+	results := utils.ParallelMap(cases, *concurrency, func(c evalCase) evalResult {
+		result := evalResult{evalCase: c}
+
+		relevant, err := sdhAgent.FindRelevantIssues(ctx, c.IssueNumber)
+		if err != nil {
+			log.Printf("❌ Failed to evaluate issue #%d: %v", c.IssueNumber, err)
+			result.Err = err
+			return result
+		}
+
+		expected := make(map[int]bool, len(c.Expected))
+		for _, number := range c.Expected {
+			expected[number] = true
+		}
+		for _, r := range relevant {
+			result.Found = append(result.Found, r.IssueContent.IssueNumber)
+			if expected[r.IssueContent.IssueNumber] {
+				result.Hits++
+			}
+		}
+		return result
+	})
+
+	printEvalSummary(results)
+}
+
+// printEvalSummary prints the precision and recall of each case and their averages
+func printEvalSummary(results []evalResult) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ISSUE\tEXPECTED\tFOUND\tHITS\tPRECISION\tRECALL")
+
+	var totalPrecision, totalRecall float64
+	evaluated := 0
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(writer, "#%d\t%v\t-\t-\t-\t-\n", result.IssueNumber, result.Expected)
+			continue
+		}
+
+		precision, recall := ratio(result.Hits, len(result.Found)), ratio(result.Hits, len(result.Expected))
+		totalPrecision += precision
+		totalRecall += recall
+		evaluated++
+
+		fmt.Fprintf(writer, "#%d\t%v\t%v\t%d\t%.2f\t%.2f\n", result.IssueNumber, result.Expected, result.Found, result.Hits, precision, recall)
+	}
+
+	fmt.Fprintf(writer, "AVERAGE\t\t\t\t%.2f\t%.2f\n", ratio64(totalPrecision, evaluated), ratio64(totalRecall, evaluated))
+	writer.Flush()
+
+	if failed := len(results) - evaluated; failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d cases could not be evaluated\n", failed)
+	}
+}
+
+// ratio returns a/b, or 0 if b is 0
+func ratio(a, b int) float64 {
+	return ratio64(float64(a), b)
+}
+
+// ratio64 returns a/b, or 0 if b is 0
+func ratio64(a float64, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return a / float64(b)
+}
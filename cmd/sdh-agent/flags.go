@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"sdh-agent/internal/agent"
+	"sdh-agent/internal/config"
+	"sdh-agent/internal/github"
+)
+
+// Output formats of reports
+const (
+	formatMarkdown = "markdown"
+	formatJSON     = "json"
+)
+
+// commonFlags are the flags shared by all commands that run the agent
+type commonFlags struct {
+	repo    string
+	model   string
+	verbose bool
+	quiet   bool
+}
+
+// register adds the common flags to a flag set
+func (f *commonFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.repo, "repo", "", "Repository as owner/name (overrides GITHUB_REPO_OWNER and GITHUB_REPO_NAME)")
+	flags.StringVar(&f.model, "model", "", "LLM model used by all pipeline stages (overrides LLM_MODEL and per-stage models)")
+	flags.BoolVar(&f.verbose, "v", false, "Verbose logging with source locations and microsecond timestamps")
+	flags.BoolVar(&f.quiet, "quiet", false, "Only print results and errors")
+}
+
+// loadConfig reads the configuration, applies the flag overrides and validates it
+func (f *commonFlags) loadConfig() *config.Configuration {
+	// Configure logging first so that configuration errors are reported consistently
+	switch {
+	case f.quiet:
+		log.SetOutput(io.Discard)
+	case f.verbose:
+		log.SetFlags(log.LstdFlags | log.Lmicroseconds | log.Lshortfile)
+	}
+
+	cfg, err := config.Read()
+	if err != nil {
+		fatalf("Failed to load configuration: %v", err)
+	}
+
+	if f.repo != "" {
+		if err := cfg.SetRepo(f.repo); err != nil {
+			fatalf("%v", err)
+		}
+	}
+
+	if f.model != "" {
+		cfg.LlmSettings.Model = f.model
+		for stage, settings := range cfg.LlmStageSettings {
+			settings.Model = ""
+			cfg.LlmStageSettings[stage] = settings
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fatalf("Invalid configuration: %v", err)
+	}
+
+	return cfg
+}
+
+// newAgent loads the configuration and initializes the agent
+func (f *commonFlags) newAgent() (*config.Configuration, *agent.SDHAgent) {
+	cfg := f.loadConfig()
+
+	sdhAgent, err := agent.NewSDHAgent(*cfg)
+	if err != nil {
+		fatalf("Failed to initialize agent: %v", err)
+	}
+
+	return cfg, sdhAgent
+}
+
+// reportOutput is the JSON representation of a report
+type reportOutput struct {
+	Owner       string `json:"owner"`
+	Repo        string `json:"repo"`
+	IssueNumber int    `json:"issue_number"`
+	// CommentID is the ID of the report comment being replaced, if any
+	CommentID int64  `json:"comment_id,omitempty"`
+	Posted    bool   `json:"posted"`
+	Body      string `json:"body"`
+}
+
+// validateFormat checks that an output format is supported
+func validateFormat(format string) error {
+	if format != formatMarkdown && format != formatJSON {
+		return fmt.Errorf("unsupported output format %q (expected %s or %s)", format, formatMarkdown, formatJSON)
+	}
+	return nil
+}
+
+// writeReport writes a report in the given format to `path`, or to stdout if `path` is empty
+func writeReport(path, format string, cfg *config.Configuration, comment *agent.ReportComment, posted bool) error {
+	var data []byte
+	if format == formatJSON {
+		var err error
+		data, err = json.MarshalIndent(reportOutput{
+			Owner:       cfg.GitHubRepoOwner,
+			Repo:        cfg.GitHubRepoName,
+			IssueNumber: comment.IssueNumber,
+			CommentID:   comment.CommentID,
+			Posted:      posted,
+			Body:        comment.Body,
+		}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode report: %w", err)
+		}
+	} else {
+		data = []byte(comment.Body)
+	}
+	data = append(data, '\n')
+
+	if path == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// isTerminal reports whether a file is a terminal rather than a pipe or a regular file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// logRateBudgets logs the remaining GitHub rate limit quota of the resources used so far
+func logRateBudgets(client *github.Client) {
+	for _, resource := range []string{github.ResourceCore, github.ResourceSearch} {
+		if budget, ok := client.RateBudget(resource); ok {
+			log.Printf("📊 GitHub %s rate limit: %d of %d requests remaining, resets at %s",
+				resource, budget.Remaining, budget.Limit, budget.Reset.Local().Format(time.TimeOnly))
+		}
+	}
+}
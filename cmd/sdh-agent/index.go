@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log"
+
+	"sdh-agent/internal/agent"
+)
+
+// runIndex embeds the closed issues of the repository into the local vector index
+func runIndex(args []string) {
+	flags := newFlagSet("index", "[flags]")
+	var common commonFlags
+	common.register(flags)
+	timeout := flags.Duration("timeout", 0, "Abort the run after this duration (e.g. 1h); 0 means no timeout")
+	query := flags.String("query", "", `GitHub search query restricting the indexed issues (e.g. "label:SDH"), overrides INDEX_QUERY`)
+	flags.Parse(args)
+
+	cfg := common.loadConfig()
+	if *query != "" {
+		cfg.IndexQuery = *query
+	}
+
+	sdhAgent, err := agent.NewSDHAgent(*cfg)
+	if err != nil {
+		fatalf("Failed to initialize agent: %v", err)
+	}
+	defer sdhAgent.Close()
+
+	ctx, cancel := newRunContext(*timeout)
+	defer cancel()
+
+	if cfg.IndexQuery != "" {
+		log.Printf("▶️  Indexing closed issues of %s/%s matching '%s' into %s", cfg.GitHubRepoOwner, cfg.GitHubRepoName, cfg.IndexQuery, cfg.IndexPath)
+	} else {
+		log.Printf("▶️  Indexing closed issues of %s/%s into %s", cfg.GitHubRepoOwner, cfg.GitHubRepoName, cfg.IndexPath)
+	}
+	indexed, err := sdhAgent.IndexIssues(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			fatalf("Indexing aborted after %d issues: %v", indexed, interruptCause(ctx))
+		}
+		fatalf("Indexing failed after %d issues: %v", indexed, err)
+	}
+
+	log.Printf("✅ Indexed %d issues", indexed)
+}
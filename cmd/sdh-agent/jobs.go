@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"sdh-agent/internal/config"
+	"sdh-agent/internal/queue"
+)
+
+// runJobs inspects and re-drives the durable job queue
+func runJobs(args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "Usage: sdh-agent jobs list [flags]")
+		fmt.Fprintln(os.Stderr, "       sdh-agent jobs retry [flags] [<job-id|issue-number>...]")
+		fmt.Fprintln(os.Stderr, "       sdh-agent jobs run [flags]")
+	}
+	if len(args) < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "list":
+		runJobsList(args[1:])
+	case "retry":
+		runJobsRetry(args[1:])
+	case "run":
+		runJobsRun(args[1:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+// runJobsList prints the jobs of the queue
+func runJobsList(args []string) {
+	flags := newFlagSet("jobs list", "[flags]")
+	var common commonFlags
+	common.register(flags)
+	status := flags.String("status", "", "Only list jobs with this status (pending, running, succeeded or failed)")
+	flags.Parse(args)
+
+	_, jobs := openQueue(&common)
+
+	list, err := jobs.List(*status)
+	if err != nil {
+		fatalf("Failed to list jobs: %v", err)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "JOB\tSTATUS\tATTEMPTS\tUPDATED\tLAST ERROR")
+	for _, job := range list {
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%s\t%s\n", job.ID, job.Status, job.Attempts, job.UpdatedAt.Format("2006-01-02 15:04:05"), job.LastError)
+	}
+	writer.Flush()
+}
+
+// runJobsRetry schedules finished or abandoned jobs to run again
+func runJobsRetry(args []string) {
+	flags := newFlagSet("jobs retry", "[flags] [<job-id|issue-number>...]")
+	var common commonFlags
+	common.register(flags)
+	failed := flags.Bool("failed", false, "Retry all failed jobs")
+	force := flags.Bool("force", false, "Also retry running jobs whose lease has not expired yet, e.g. after killing their worker")
+	flags.Parse(args)
+
+	cfg, jobs := openQueue(&common)
+
+	// Jobs can be referenced by ID or by issue number of the configured repository
+	var ids []string
+	for _, arg := range flags.Args() {
+		if issueNumber, err := strconv.Atoi(arg); err == nil {
+			ids = append(ids, queue.JobID(cfg.GitHubRepoOwner, cfg.GitHubRepoName, issueNumber))
+		} else {
+			ids = append(ids, arg)
+		}
+	}
+	if *failed {
+		list, err := jobs.List(queue.StatusFailed)
+		if err != nil {
+			fatalf("Failed to list jobs: %v", err)
+		}
+		for _, job := range list {
+			ids = append(ids, job.ID)
+		}
+	}
+
+	for _, id := range ids {
+		if _, err := jobs.Retry(id, *force); err != nil {
+			log.Printf("❌ Failed to retry job %s: %v", id, err)
+			continue
+		}
+		log.Printf("🔁 Job %s scheduled", id)
+	}
+}
+
+// runJobsRun processes pending jobs until the queue is idle
+func runJobsRun(args []string) {
+	flags := newFlagSet("jobs run", "[flags]")
+	var common commonFlags
+	common.register(flags)
+	timeout := flags.Duration("timeout", 0, "Abort the run after this duration (e.g. 1h); 0 means no timeout")
+	flags.Parse(args)
+
+	cfg, sdhAgent := common.newAgent()
+	defer sdhAgent.Close()
+
+	jobs, err := queue.Open(cfg.QueuePath)
+	if err != nil {
+		fatalf("Failed to open job queue: %v", err)
+	}
+
+	ctx, cancel := newRunContext(*timeout)
+	defer cancel()
+
+	jobs.Work(ctx, queue.WorkOptions{
+		Workers:      cfg.WebhookWorkers,
+		MaxAttempts:  cfg.QueueMaxAttempts,
+		ExitWhenIdle: true,
+	}, func(ctx context.Context, job *queue.Job) error {
+		return sdhAgent.AnalyzeAndPublish(ctx, job.IssueNumber)
+	})
+
+	log.Println("✅ No more jobs due")
+}
+
+// openQueue loads the configuration and opens the job queue
+func openQueue(common *commonFlags) (*config.Configuration, *queue.Queue) {
+	cfg := common.loadConfig()
+
+	jobs, err := queue.Open(cfg.QueuePath)
+	if err != nil {
+		fatalf("Failed to open job queue: %v", err)
+	}
+
+	return cfg, jobs
+}
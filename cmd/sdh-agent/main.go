@@ -1,46 +1,136 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
-	"sdh-agent/internal/agent"
-	"sdh-agent/internal/config"
+	"sdh-agent/internal/github"
 )
 
+// command is a subcommand of the CLI
+type command struct {
+	name    string
+	summary string
+	run     func(args []string)
+}
+
+// commands lists the subcommands of the CLI in the order they are shown in the usage
+var commands = []command{
+	{"analyze", "Analyze an SDH issue and optionally post the report on it", runAnalyze},
+	{"batch", "Analyze many issues selected by a search query or by number", runBatch},
+	{"serve", "Listen for GitHub webhooks and analyze issues automatically", runServe},
+	{"index", "Embed closed issues into the local vector index", runIndex},
+	{"jobs", "Inspect and re-drive the durable job queue", runJobs},
+	{"config", "Check the configuration", runConfig},
+	{"eval", "Evaluate similar-issue retrieval against known related issues", runEval},
+}
+
 func main() {
-	// Load configuration from environment variables
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatalf("❌ Failed to load configuration: %v", err)
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
 	}
 
-	// Get issue number from command line arguments
-	if len(os.Args) < 2 {
-		log.Fatal("Usage: sdh-agent <issue-number>")
+	name, args := route(os.Args[1:])
+	if name == "help" {
+		usage()
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			cmd.run(args)
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+// route returns the name of the command to run for the command line arguments and the arguments of the command.
+// Arguments starting with a flag or an issue reference run `analyze`, to keep supporting the original
+// `sdh-agent [--post] <issue-number>` form.
+func route(args []string) (string, []string) {
+	first := args[0]
+	switch {
+	case first == "help" || first == "-h" || first == "--help":
+		return "help", nil
+	case strings.HasPrefix(first, "-"):
+		return "analyze", args
 	}
 
-	var issueNumber int
-	_, err = fmt.Sscanf(os.Args[1], "%d", &issueNumber)
-	if err != nil {
-		log.Fatal("Invalid issue number")
+	if _, err := github.ParseIssueReference(first); err == nil {
+		return "analyze", args
 	}
+	return first, args[1:]
+}
+
+// usage prints the list of commands
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: sdh-agent <command> [flags] [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'sdh-agent <command> --help' for the flags of a command.")
+}
+
+// newFlagSet creates the flag set of a command with a usage line
+func newFlagSet(name, usageLine string) *flag.FlagSet {
+	flags := flag.NewFlagSet("sdh-agent "+name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: sdh-agent %s %s\n\nFlags:\n", name, usageLine)
+		flags.PrintDefaults()
+	}
+	return flags
+}
 
-	// Initialize and run the agent
-	sdhAgent := agent.NewSDHAgent(*cfg)
+// newRunContext returns a context cancelled on Ctrl-C / SIGTERM or once the timeout expires (0 means no timeout)
+func newRunContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if timeout <= 0 {
+		return ctx, stop
+	}
 
-	log.Printf("▶️  Starting analysis for issue: #%d\n", issueNumber)
-	report, err := sdhAgent.ProcessIssue(issueNumber)
-	if err != nil {
-		log.Fatalf("❌ An error occurred during processing: %v", err)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
 	}
+}
 
-	log.Println("✅ Successfully processed issue and generated report:")
-	log.Println("===== REPORT BEGIN =====")
+// interruptCause describes why the context of the run was cancelled
+func interruptCause(ctx context.Context) string {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "timeout exceeded"
+	}
+	return "interrupted"
+}
 
-	// Print the final report
-	fmt.Println(report)
+// fatalf prints an error to stderr, even when logging is silenced by --quiet, and exits
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "❌ "+format+"\n", args...)
+	os.Exit(1)
+}
 
-	log.Println("===== REPORT END =====")
+// isFlagSet reports whether the flag with the given name was passed on the command line
+func isFlagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestRoute checks that command lines are routed to their command, including the original analyze form
+func TestRoute(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantName string
+		wantArgs []string
+	}{
+		{args: []string{"analyze", "--post", "123"}, wantName: "analyze", wantArgs: []string{"--post", "123"}},
+		{args: []string{"batch", "1-3"}, wantName: "batch", wantArgs: []string{"1-3"}},
+		{args: []string{"jobs", "retry", "--force", "123"}, wantName: "jobs", wantArgs: []string{"retry", "--force", "123"}},
+		{args: []string{"serve"}, wantName: "serve", wantArgs: []string{}},
+		{args: []string{"123"}, wantName: "analyze", wantArgs: []string{"123"}},
+		{args: []string{"#123"}, wantName: "analyze", wantArgs: []string{"#123"}},
+		{args: []string{"org/repo#123", "--post"}, wantName: "analyze", wantArgs: []string{"org/repo#123", "--post"}},
+		{args: []string{"https://github.com/org/repo/issues/123"}, wantName: "analyze", wantArgs: []string{"https://github.com/org/repo/issues/123"}},
+		{args: []string{"--post", "123"}, wantName: "analyze", wantArgs: []string{"--post", "123"}},
+		{args: []string{"-model", "gpt-4o", "123"}, wantName: "analyze", wantArgs: []string{"-model", "gpt-4o", "123"}},
+		{args: []string{"help"}, wantName: "help"},
+		{args: []string{"-h"}, wantName: "help"},
+		{args: []string{"--help"}, wantName: "help"},
+		{args: []string{"deploy", "now"}, wantName: "deploy", wantArgs: []string{"now"}},
+	}
+
+	for _, tt := range tests {
+		name, args := route(tt.args)
+		if name != tt.wantName || !slices.Equal(args, tt.wantArgs) {
+			t.Errorf("route(%q) = %q, %q, want %q, %q", tt.args, name, args, tt.wantName, tt.wantArgs)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log"
+
+	"sdh-agent/internal/queue"
+	"sdh-agent/internal/server"
+)
+
+// runServe listens for GitHub webhooks and analyzes matching issues as they are opened
+func runServe(args []string) {
+	flags := newFlagSet("serve", "[flags]")
+	var common commonFlags
+	common.register(flags)
+	addr := flags.String("addr", "", "Address to listen on (overrides SERVER_ADDR)")
+	flags.Parse(args)
+
+	cfg, sdhAgent := common.newAgent()
+	defer sdhAgent.Close()
+
+	if *addr != "" {
+		cfg.ServerAddr = *addr
+	}
+
+	jobs, err := queue.Open(cfg.QueuePath)
+	if err != nil {
+		fatalf("Failed to open job queue: %v", err)
+	}
+
+	webhookServer, err := server.New(*cfg, sdhAgent, jobs)
+	if err != nil {
+		fatalf("Failed to initialize server: %v", err)
+	}
+
+	// Run until Ctrl-C / SIGTERM
+	ctx, cancel := newRunContext(0)
+	defer cancel()
+
+	if err := webhookServer.Run(ctx); err != nil {
+		fatalf("Server error: %v", err)
+	}
+	log.Println("👋 Server stopped")
+}
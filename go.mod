@@ -5,8 +5,12 @@ go 1.24.2
 require (
 	github.com/google/go-github/v63 v63.0.0
 	github.com/joho/godotenv v1.5.1
+	go.etcd.io/bbolt v1.4.3
 	golang.org/x/oauth2 v0.30.0
 	golang.org/x/time v0.12.0
 )
 
-require github.com/google/go-querystring v1.1.0 // indirect
+require (
+	github.com/google/go-querystring v1.1.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+)
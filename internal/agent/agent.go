@@ -1,40 +1,175 @@
 package agent
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"time"
 
+	"sdh-agent/internal/cache"
 	"sdh-agent/internal/config"
 	"sdh-agent/internal/github"
 	"sdh-agent/internal/llm"
+	"sdh-agent/internal/prompts"
 )
 
 // NewSDHAgent creates a new SDH agent instance
-func NewSDHAgent(config config.Configuration) *SDHAgent {
+func NewSDHAgent(cfg config.Configuration) (*SDHAgent, error) {
+	var err error
+
+	// Open the issue cache, running without it if it is unavailable
+	var issueCache *cache.Cache
+	if !cfg.CacheDisabled {
+		if issueCache, err = cache.Open(cfg.CachePath); err != nil {
+			log.Printf("Issue cache disabled: %v", err)
+		}
+	}
+
 	// Initialize API clients
-	githubClient := github.NewClient(config.GitHubToken)
-	llmClient := llm.NewClient(config.LlmApiKey)
+	githubOptions := github.Options{
+		MaxComments:      cfg.GitHubMaxComments,
+		MaxSearchResults: cfg.GitHubMaxSearchResults,
+		Cache:            issueCache,
+		BaseURL:          cfg.GitHubBaseURL,
+		UploadURL:        cfg.GitHubUploadURL,
+	}
+	if cfg.UsesGitHubApp() {
+		githubOptions.App = &github.AppCredentials{
+			AppID:          cfg.GitHubAppID,
+			InstallationID: cfg.GitHubAppInstallationID,
+			PrivateKey:     []byte(cfg.GitHubAppPrivateKey),
+		}
+	}
+	githubClient, err := github.NewClient(cfg.GitHubToken, githubOptions)
+	if err != nil {
+		if issueCache != nil {
+			issueCache.Close()
+		}
+		return nil, err
+	}
+
+	// Create one LLM client per pipeline stage so each can use its own model settings
+	llmClients := make(map[string]llm.Client, len(config.Stages))
+	for _, stage := range config.Stages {
+		settings := cfg.StageSettings(stage)
+		llmClient, err := llm.NewClient(llm.Config{
+			Provider:     cfg.LlmProvider,
+			APIKey:       cfg.LlmApiKey,
+			BaseURL:      cfg.LlmBaseURL,
+			Model:        settings.Model,
+			MaxTokens:    settings.MaxTokens,
+			Temperature:  settings.Temperature,
+			RetryBackoff: cfg.LlmRetryBackoff,
+		})
+		if err != nil {
+			if issueCache != nil {
+				issueCache.Close()
+			}
+			return nil, fmt.Errorf("failed to create LLM client for the %s stage: %w", stage, err)
+		}
+		llmClients[stage] = llm.Metered(llmClient)
+	}
 
 	return &SDHAgent{
-		config:       config,
-		llmClient:    llmClient,
+		config:     cfg,
+		llmClients: llmClients,
+		embedder: llm.NewEmbedder(llm.EmbeddingConfig{
+			APIKey:  cfg.EmbeddingApiKey,
+			BaseURL: cfg.EmbeddingBaseURL,
+			Model:   cfg.EmbeddingModel,
+		}),
 		githubClient: githubClient,
+		cache:        issueCache,
+	}, nil
+}
+
+// Close releases the resources held by the agent
+func (agent *SDHAgent) Close() error {
+	if agent.cache != nil {
+		return agent.cache.Close()
 	}
+	return nil
+}
+
+// GitHubClient returns the GitHub client used by the agent
+func (agent *SDHAgent) GitHubClient() *github.Client {
+	return agent.githubClient
+}
+
+// llmFor returns the LLM client configured for a pipeline stage
+func (agent *SDHAgent) llmFor(stage string) llm.Client {
+	return agent.llmClients[stage]
+}
+
+// generate sends a request to the LLM of a pipeline stage, with the SDH context as system prompt
+// unless the request has its own
+func (agent *SDHAgent) generate(ctx context.Context, stage string, req llm.Request) (*llm.Response, error) {
+	return agent.stream(ctx, stage, req, nil)
+}
+
+// stream is like generate, but calls `onText` with each piece of text as it is generated
+// unless `onText` is nil
+func (agent *SDHAgent) stream(ctx context.Context, stage string, req llm.Request, onText func(text string)) (*llm.Response, error) {
+	if req.System == "" {
+		req.System = prompts.SDHContext
+	}
+
+	client := agent.llmFor(stage)
+	if onText == nil {
+		return client.Generate(ctx, req)
+	}
+	return llm.Stream(ctx, client, req, onText)
+}
+
+// generateText sends `messages` as user messages to the LLM of a pipeline stage and returns the generated text
+func (agent *SDHAgent) generateText(ctx context.Context, stage string, messages []string) (string, error) {
+	response, err := agent.generate(ctx, stage, llm.Request{Messages: llm.UserMessages(messages...)})
+	if err != nil {
+		return "", err
+	}
+	return response.Text, nil
+}
+
+// concurrency returns the number of GitHub or LLM calls the agent may run in parallel
+func (agent *SDHAgent) concurrency() int {
+	if agent.config.Concurrency < 1 {
+		return config.DefaultConcurrency
+	}
+	return agent.config.Concurrency
+}
+
+// meterRun attaches a usage meter enforcing the run budget to the context, recording usage
+// in the meter already attached to the context (e.g. by a batch) as well
+func (agent *SDHAgent) meterRun(ctx context.Context) (context.Context, *llm.UsageMeter) {
+	meter := llm.NewUsageMeter(llm.Budget{
+		MaxCost:   agent.config.MaxRunCost,
+		MaxTokens: agent.config.MaxRunTokens,
+	}, llm.UsageMeterFrom(ctx))
+	return llm.WithUsageMeter(ctx, meter), meter
 }
 
 // ProcessIssue executes the full workflow for a given SDH issue
-func (agent *SDHAgent) ProcessIssue(issueNumber int) (string, error) {
+func (agent *SDHAgent) ProcessIssue(ctx context.Context, issueNumber int) (string, error) {
+	return agent.ProcessIssueStreaming(ctx, issueNumber, nil)
+}
+
+// ProcessIssueStreaming is like ProcessIssue, but streams the report, calling `onReportText` with each
+// piece of the report text as it is generated. The returned report is complete, with header and footer.
+func (agent *SDHAgent) ProcessIssueStreaming(ctx context.Context, issueNumber int, onReportText func(text string)) (string, error) {
 	log.Printf("Starting to process SDH issue #%d", issueNumber)
 
+	// Meter the LLM usage and cost of the run against its budget
+	ctx, meter := agent.meterRun(ctx)
+
 	// Ingest active SDH issue
-	issueContent, err := agent.githubClient.GetIssueContent(agent.config.GitHubRepoOwner, agent.config.GitHubRepoName, issueNumber)
+	issueContent, err := agent.githubClient.GetIssueContent(ctx, agent.config.GitHubRepoOwner, agent.config.GitHubRepoName, issueNumber)
 	if err != nil {
 		return "", fmt.Errorf("failed to ingest main SDH issue #%d: %w", issueNumber, err)
 	}
 
 	// Summarize the issue
 	log.Printf("Summarizing content for SDH issue")
-	summary, err := agent.summarizeIssueContent(issueContent)
+	summary, err := agent.summarizeIssueContent(ctx, issueContent)
 	if err != nil {
 		return "", fmt.Errorf("failed to summarize issue content: %w", err)
 	}
@@ -42,18 +177,119 @@ func (agent *SDHAgent) ProcessIssue(issueNumber int) (string, error) {
 
 	// Analyze similar issues
 	log.Printf("Analyzing similar issues")
-	analysisResults, err := agent.analyzeSimilarIssues(issueContent, summary)
+	analysisResults, err := agent.analyzeSimilarIssues(ctx, issueContent, summary)
 	if err != nil {
 		return "", fmt.Errorf("failed to analyze similar issues: %w", err)
 	}
 
 	// Generate report
 	log.Printf("Generating final report")
-	report, err := agent.generateReport(issueContent, summary, analysisResults)
+	report, err := agent.generateReport(ctx, issueContent, summary, analysisResults, onReportText)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate report: %w", err)
 	}
 
-	log.Printf("Successfully processed SDH issue #%d", issueNumber)
+	log.Printf("Successfully processed SDH issue #%d (%s)", issueNumber, meter.Total())
 	return report, nil
 }
+
+// PrepareReportComment builds the comment body for a report, carrying over the revision
+// history of the agent's previous report comment on the issue if there is one
+func (agent *SDHAgent) PrepareReportComment(ctx context.Context, issueNumber int, report string) (*ReportComment, error) {
+	previous, err := agent.githubClient.FindComment(ctx, agent.config.GitHubRepoOwner, agent.config.GitHubRepoName, issueNumber, reportMarker)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up previous report for SDH issue #%d: %w", issueNumber, err)
+	}
+
+	timestamp := time.Now().UTC().Format(reportTimestampFormat)
+	comment := &ReportComment{IssueNumber: issueNumber}
+
+	var revisions []string
+	if previous == nil {
+		revisions = []string{fmt.Sprintf("%s: report created", timestamp)}
+	} else {
+		comment.CommentID = previous.GetID()
+		revisions = append([]string{fmt.Sprintf("%s: report updated", timestamp)}, parseRevisionHistory(previous.GetBody())...)
+	}
+	comment.Body = formatRevisionHistory(report, revisions)
+
+	return comment, nil
+}
+
+// PublishReport posts the report comment on its SDH issue, editing the previous report in place if one exists
+func (agent *SDHAgent) PublishReport(ctx context.Context, comment *ReportComment) error {
+	owner, repo := agent.config.GitHubRepoOwner, agent.config.GitHubRepoName
+
+	if comment.CommentID != 0 {
+		log.Printf("Updating report comment %d on SDH issue #%d", comment.CommentID, comment.IssueNumber)
+		if err := agent.githubClient.EditComment(ctx, owner, repo, comment.CommentID, comment.Body); err != nil {
+			return fmt.Errorf("failed to update report on SDH issue #%d: %w", comment.IssueNumber, err)
+		}
+		return nil
+	}
+
+	log.Printf("Posting report to SDH issue #%d", comment.IssueNumber)
+	if err := agent.githubClient.PostComment(ctx, owner, repo, comment.IssueNumber, comment.Body); err != nil {
+		return fmt.Errorf("failed to post report to SDH issue #%d: %w", comment.IssueNumber, err)
+	}
+
+	return nil
+}
+
+// AnalyzeAndPublish processes an SDH issue and posts the report on it, updating the previous report if any
+func (agent *SDHAgent) AnalyzeAndPublish(ctx context.Context, issueNumber int) error {
+	report, err := agent.ProcessIssue(ctx, issueNumber)
+	if err != nil {
+		return err
+	}
+
+	comment, err := agent.PrepareReportComment(ctx, issueNumber, report)
+	if err != nil {
+		return err
+	}
+
+	return agent.PublishReport(ctx, comment)
+}
+
+// FindIssueNumbers returns the numbers of up to `limit` issues matching a GitHub search query
+func (agent *SDHAgent) FindIssueNumbers(ctx context.Context, query string, limit int) ([]int, error) {
+	issues, err := agent.githubClient.FindIssues(ctx, agent.config.GitHubRepoOwner, agent.config.GitHubRepoName, query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	numbers := make([]int, 0, len(issues))
+	for _, issue := range issues {
+		numbers = append(numbers, issue.GetNumber())
+	}
+
+	return numbers, nil
+}
+
+// FindRelevantIssues runs the retrieval and relevance steps of the pipeline for an SDH issue,
+// without generating a report, and returns the relevant similar issues in ranked order
+func (agent *SDHAgent) FindRelevantIssues(ctx context.Context, issueNumber int) ([]AnalyzisResult, error) {
+	ctx, _ = agent.meterRun(ctx)
+
+	issueContent, err := agent.githubClient.GetIssueContent(ctx, agent.config.GitHubRepoOwner, agent.config.GitHubRepoName, issueNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to ingest main SDH issue #%d: %w", issueNumber, err)
+	}
+
+	summary, err := agent.summarizeIssueContent(ctx, issueContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize issue content: %w", err)
+	}
+
+	results, err := agent.analyzeSimilarIssues(ctx, issueContent, summary)
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze similar issues: %w", err)
+	}
+
+	return results, nil
+}
+
+// CheckGitHubAccess verifies that the configured repository can be read
+func (agent *SDHAgent) CheckGitHubAccess(ctx context.Context) error {
+	return agent.githubClient.CheckRepoAccess(ctx, agent.config.GitHubRepoOwner, agent.config.GitHubRepoName)
+}
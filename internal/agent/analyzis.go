@@ -1,49 +1,95 @@
 package agent
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sort"
 	"time"
 
+	"sdh-agent/internal/config"
 	"sdh-agent/internal/github"
+	"sdh-agent/internal/llm"
 	"sdh-agent/internal/prompts"
+	"sdh-agent/pkg/utils"
+
+	gogithub "github.com/google/go-github/v63/github"
+)
+
+// errReportReserve is returned for relevance checks that would draw on the budget share kept for the report
+var errReportReserve = errors.New("LLM budget reserved for the report")
+
+const (
+	// maxRelevantIssues limits the number of relevant issues included in the report to prevent token overflow
+	maxRelevantIssues = 10
+	// reportBudgetShare is the share of the run budget kept for generating the report
+	reportBudgetShare = 0.2
+	// relevanceCachePrefix is the number of relevance prompt messages shared by all similar issues
+	relevanceCachePrefix = 2
 )
 
 // analyzeSimilarIssues analyzes each similar issue for relevance
-func (agent *SDHAgent) analyzeSimilarIssues(mainIssue *github.GitHubIssueContent, mainSummary string) ([]AnalyzisResult, error) {
+func (agent *SDHAgent) analyzeSimilarIssues(ctx context.Context, mainIssue *github.GitHubIssueContent, mainSummary string) ([]AnalyzisResult, error) {
 	var results []AnalyzisResult
 
 	// Identify and filter similar issues
-	similarIssues, err := agent.findSimilarIssues(mainIssue, mainSummary)
+	similarIssues, err := agent.findSimilarIssues(ctx, mainIssue, mainSummary)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find similar issues: %w", err)
 	}
 
-	// Sort the fetched issues by metadata score
-	sort.Slice(similarIssues, func(i, j int) bool {
+	// Sort the fetched issues by metadata score, keeping search order for ties
+	sort.SliceStable(similarIssues, func(i, j int) bool {
 		return scoreIssueByMetadata(mainIssue, similarIssues[i]) > scoreIssueByMetadata(mainIssue, similarIssues[j])
 	})
 
-	for _, issue := range similarIssues {
-		// Limit analysis to prevent token overflow
-		if len(results) >= 10 {
-			break
+	// Analyze issues in ranked batches of `concurrency` so that results keep the ranked order
+	// and no more LLM calls are made than needed once enough relevant issues are found
+	concurrency := agent.concurrency()
+	for start := 0; start < len(similarIssues) && len(results) < maxRelevantIssues; start += concurrency {
+		// Stop early if the run was cancelled
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
 
-		// Analyze relevance
-		relevance, resolution, err := agent.analyzeIssueRelevance(mainSummary, mainIssue, issue)
-		if err != nil {
-			log.Printf("Error analyzing issue #%d: %v", issue.IssueNumber, err)
-			continue
+		// Keep part of the budget for the report by skipping the remaining relevance checks
+		if meter := llm.UsageMeterFrom(ctx); meter != nil && meter.BudgetUsed() >= 1-reportBudgetShare {
+			log.Printf("LLM budget %.0f%% used, skipping the relevance checks of the remaining %d similar issues",
+				100*meter.BudgetUsed(), len(similarIssues)-start)
+			break
 		}
 
-		if relevance {
-			log.Printf("Issue #%d is relevant: %s", issue.IssueNumber, resolution)
-			results = append(results, AnalyzisResult{
-				IssueContent: issue,
-				Resolution:   resolution,
-			})
+		batch := similarIssues[start:min(start+concurrency, len(similarIssues))]
+
+		batchResults := utils.ParallelMap(batch, concurrency, func(issue *github.GitHubIssueContent) *AnalyzisResult {
+			// Analyze relevance
+			analysis, err := agent.analyzeIssueRelevance(ctx, mainSummary, mainIssue, issue)
+			if errors.Is(err, errReportReserve) {
+				log.Printf("Skipping the relevance check of issue #%d: %v", issue.IssueNumber, err)
+				return nil
+			}
+			if err != nil {
+				log.Printf("Error analyzing issue #%d: %v", issue.IssueNumber, err)
+				return nil
+			}
+
+			if !analysis.Relevant {
+				return nil
+			}
+
+			log.Printf("Issue #%d is relevant (confidence %.2f): %s", issue.IssueNumber, analysis.Confidence, analysis.Resolution)
+			return &AnalyzisResult{
+				IssueContent:      issue,
+				RelevanceAnalysis: *analysis,
+			}
+		})
+
+		for _, result := range batchResults {
+			// Limit analysis to prevent token overflow
+			if result != nil && len(results) < maxRelevantIssues {
+				results = append(results, *result)
+			}
 		}
 	}
 
@@ -51,32 +97,69 @@ func (agent *SDHAgent) analyzeSimilarIssues(mainIssue *github.GitHubIssueContent
 }
 
 // analyzeIssueRelevance determines if an issue is relevant
-func (agent *SDHAgent) analyzeIssueRelevance(mainSummary string, mainIssue, similarIssue *github.GitHubIssueContent) (bool, string, error) {
+func (agent *SDHAgent) analyzeIssueRelevance(ctx context.Context, mainSummary string, mainIssue, similarIssue *github.GitHubIssueContent) (*RelevanceAnalysis, error) {
 	log.Printf("Analyzing relevance for issue #%d", similarIssue.IssueNumber)
 
-	var messages []string
+	messages := llm.UserMessages(
+		// Create a prompt for relevance analysis
+		prompts.CreateRelevanceAnalysisPrompt(mainIssue.IssueNumber),
+		// Add main issue summary
+		fmt.Sprintf("Main Issue Summary:\n%s", mainSummary),
+		// Add similar issue content
+		fmt.Sprintf("Similar Issue #%d Content:\n%s", similarIssue.IssueNumber, formatIssueContent(similarIssue)),
+	)
 
-	// Create a prompt for relevance analysis
-	prompt := prompts.CreateRelevanceAnalysisPrompt(mainIssue.IssueNumber, similarIssue.IssueNumber)
-	messages = append(messages, prompt)
+	response, err := agent.generateRelevance(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Relevance analysis response for issue #%d: %s", similarIssue.IssueNumber, response)
 
-	// Add main issue summary
-	messages = append(messages, fmt.Sprintf("Main Issue Summary:\n%s", mainSummary))
+	// Parse the response
+	analysis, err := parseRelevanceResponse(response)
+	if err == nil {
+		return analysis, nil
+	}
 
-	// Add similar issue content
-	messages = append(messages, fmt.Sprintf("Similar Issue Content:\n%s", formatIssueContent(similarIssue)))
+	// Ask the LLM once to repair its malformed response
+	log.Printf("Invalid relevance analysis for issue #%d, asking for a repaired response: %v", similarIssue.IssueNumber, err)
+	messages = append(messages,
+		llm.Message{Role: llm.RoleAssistant, Content: response},
+		llm.Message{Role: llm.RoleUser, Content: prompts.CreateRelevanceRepairPrompt(err.Error())},
+	)
 
-	response, err := agent.llmClient.GenerateText(messages)
+	response, err = agent.generateRelevance(ctx, messages)
 	if err != nil {
-		return false, "", err
+		return nil, err
 	}
 
-	log.Printf("Relevance analysis response for issue #%d: %s", similarIssue.IssueNumber, response)
+	log.Printf("Repaired relevance analysis response for issue #%d: %s", similarIssue.IssueNumber, response)
 
-	// Parse the response
-	relevant, resolution := parseRelevanceResponse(response)
+	analysis, err = parseRelevanceResponse(response)
+	if err != nil {
+		return nil, fmt.Errorf("invalid relevance analysis after repair: %w", err)
+	}
 
-	return relevant, resolution, nil
+	return analysis, nil
+}
+
+// generateRelevance sends a relevance analysis prompt to the LLM. The prompt and main issue summary
+// are the same for all similar issues of a run, so they are cached by providers supporting it.
+// Calls are refused with errReportReserve once the budget share kept for the report is reached.
+func (agent *SDHAgent) generateRelevance(ctx context.Context, messages []llm.Message) (string, error) {
+	if meter := llm.UsageMeterFrom(ctx); meter != nil && meter.BudgetUsed() >= 1-reportBudgetShare {
+		return "", errReportReserve
+	}
+
+	response, err := agent.generate(ctx, config.StageRelevance, llm.Request{
+		Messages:    messages,
+		CachePrefix: relevanceCachePrefix,
+	})
+	if err != nil {
+		return "", err
+	}
+	return response.Text, nil
 }
 
 // scoreIssueByMetadata Provides a basic scoring mechanism based on issue metadata
@@ -115,59 +198,98 @@ func scoreIssueByMetadata(mainIssue, otherIssue *github.GitHubIssueContent) floa
 }
 
 // findSimilarIssues searches for related issues
-func (agent *SDHAgent) findSimilarIssues(mainIssue *github.GitHubIssueContent, summary string) ([]*github.GitHubIssueContent, error) {
+func (agent *SDHAgent) findSimilarIssues(ctx context.Context, mainIssue *github.GitHubIssueContent, summary string) ([]*github.GitHubIssueContent, error) {
 	log.Printf("Searching for similar issues")
 
 	// Extract search terms from the issue
-	searchQueries := agent.extractSearchQueries(summary)
+	searchQueries, err := agent.extractSearchQueries(ctx, summary)
+	if err != nil {
+		return nil, err
+	}
 
-	var allIssues []*github.GitHubIssueContent
+	var candidates []*gogithub.Issue
 	seenIssues := make(map[int]bool)
 
 	for _, query := range searchQueries {
+		// Stop early if the run was cancelled
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		log.Printf("Searching with query '%s'", query)
-		results, err := agent.githubClient.SearchIssues(agent.config.GitHubRepoOwner, agent.config.GitHubRepoName, query)
+		results, err := agent.githubClient.SearchIssues(ctx, agent.config.GitHubRepoOwner, agent.config.GitHubRepoName, query)
 		if err != nil {
 			log.Printf("Error searching with query '%s': %v", query, err)
 			continue
 		}
 
 		for _, issue := range results {
+			// Ensure the issue is not already processed
 			if issue.Number != nil && *issue.Number != mainIssue.IssueNumber && !seenIssues[*issue.Number] {
-				// Ingest similar issue
-				comments, err := agent.githubClient.GetIssueComments(agent.config.GitHubRepoOwner, agent.config.GitHubRepoName, issue)
-
-				if err != nil {
-					log.Printf("Error ingesting comments for issue #%d: %v", *issue.Number, err)
-					continue
-				}
+				seenIssues[*issue.Number] = true
+				candidates = append(candidates, issue)
+			}
+		}
+	}
 
-				issueContent := &github.GitHubIssueContent{
-					IssueNumber: *issue.Number,
-					Issue:       issue,
-					Comments:    comments,
-				}
+	// Add nearest neighbours from the local vector index
+	if agent.config.RetrievalMode == config.RetrievalHybrid {
+		neighbours, err := agent.findNearestIssues(ctx, mainIssue, summary)
+		if err != nil {
+			log.Printf("Error retrieving nearest neighbours: %v", err)
+		}
 
-				// Ensure the issue is not already processed
-				seenIssues[*issue.Number] = true
-				allIssues = append(allIssues, issueContent)
+		for _, issue := range neighbours {
+			if !seenIssues[issue.GetNumber()] {
+				seenIssues[issue.GetNumber()] = true
+				candidates = append(candidates, issue)
 			}
 		}
 	}
 
+	// Ingest similar issues concurrently
+	ingested := utils.ParallelMap(candidates, agent.concurrency(), func(issue *gogithub.Issue) *github.GitHubIssueContent {
+		comments, err := agent.githubClient.GetIssueComments(ctx, agent.config.GitHubRepoOwner, agent.config.GitHubRepoName, issue)
+		if err != nil {
+			log.Printf("Error ingesting comments for issue #%d: %v", *issue.Number, err)
+			return nil
+		}
+
+		return &github.GitHubIssueContent{
+			IssueNumber: *issue.Number,
+			Issue:       issue,
+			Comments:    comments,
+		}
+	})
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var allIssues []*github.GitHubIssueContent
+	for _, issueContent := range ingested {
+		if issueContent != nil {
+			allIssues = append(allIssues, issueContent)
+		}
+	}
+
 	return allIssues, nil
 }
 
-// extractSearchQueries generates search queries from the issue using LLM
-func (agent *SDHAgent) extractSearchQueries(summary string) []string {
+// extractSearchQueries generates search queries from the issue using LLM.
+// LLM failures leave the search to the vector index, except an exhausted budget, which fails the run.
+func (agent *SDHAgent) extractSearchQueries(ctx context.Context, summary string) ([]string, error) {
 	// Create prompt for LLM to generate search queries
 	prompt := prompts.CreateSearchQueriesPrompt(summary)
 
 	// Get response from LLM
-	response, err := agent.llmClient.GenerateText([]string{prompt})
+	response, err := agent.generateText(ctx, config.StageQueries, []string{prompt})
+	if errors.Is(err, llm.ErrBudgetExceeded) {
+		return nil, fmt.Errorf("failed to generate search queries: %w", err)
+	}
 	if err != nil {
 		log.Printf("Error generating search queries: %v", err)
-		return []string{} // Return empty slice if LLM fails
+		return []string{}, nil // Return empty slice if LLM fails
 	}
 
 	// Parse the response into individual queries
@@ -178,11 +300,11 @@ func (agent *SDHAgent) extractSearchQueries(summary string) []string {
 		queries = queries[:5]
 	}
 
-	return queries
+	return queries, nil
 }
 
 // summarizeIssueContent uses an LLM to summarize the issue
-func (agent *SDHAgent) summarizeIssueContent(issueContent *github.GitHubIssueContent) (string, error) {
+func (agent *SDHAgent) summarizeIssueContent(ctx context.Context, issueContent *github.GitHubIssueContent) (string, error) {
 	var messages []string
 
 	// Create a prompt for summarization
@@ -190,7 +312,7 @@ func (agent *SDHAgent) summarizeIssueContent(issueContent *github.GitHubIssueCon
 	messages = append(messages, prompt)
 	messages = append(messages, formatIssueContent(issueContent)...)
 
-	response, err := agent.llmClient.GenerateText(messages)
+	response, err := agent.generateText(ctx, config.StageSummary, messages)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,187 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"sdh-agent/internal/github"
+	"sdh-agent/internal/index"
+	"sdh-agent/pkg/utils"
+
+	gogithub "github.com/google/go-github/v63/github"
+)
+
+const (
+	// embeddingBatchSize is the number of issues embedded per API call
+	embeddingBatchSize = 16
+	// maxEmbeddingChars limits the text embedded per issue to stay within embedding model limits
+	maxEmbeddingChars = 8000
+	// resolutionComments is the number of final comments embedded with an issue, as they usually hold its resolution
+	resolutionComments = 3
+	// maxIndexQueryResults is the number of issues GitHub search returns at most for a query
+	maxIndexQueryResults = 1000
+)
+
+// IndexIssues embeds the closed issues of the repository matching the configured index query,
+// or all of them if there is none, into the local vector index.
+// Issues that have not changed since they were last indexed are skipped.
+// It returns the number of issues that were (re-)indexed.
+func (agent *SDHAgent) IndexIssues(ctx context.Context) (int, error) {
+	host, owner, repo := agent.config.GitHubHost(), agent.config.GitHubRepoOwner, agent.config.GitHubRepoName
+
+	vectorIndex, err := index.Load(agent.config.IndexPath)
+	if err != nil {
+		return 0, err
+	}
+
+	issues, err := agent.listIssuesToIndex(ctx, owner, repo)
+	if err != nil {
+		return 0, err
+	}
+
+	// Only embed issues that are new or were updated since they were indexed
+	var outdated []*gogithub.Issue
+	for _, issue := range issues {
+		doc := vectorIndex.Get(host, owner, repo, issue.GetNumber())
+		if doc == nil || !doc.UpdatedAt.Equal(issue.GetUpdatedAt().Time) {
+			outdated = append(outdated, issue)
+		}
+	}
+	log.Printf("Found %d closed issues, %d need to be indexed", len(issues), len(outdated))
+
+	indexed := 0
+	for start := 0; start < len(outdated); start += embeddingBatchSize {
+		batch := outdated[start:min(start+embeddingBatchSize, len(outdated))]
+
+		// Ingest the comments of the batch concurrently
+		contents := utils.ParallelMap(batch, agent.concurrency(), func(issue *gogithub.Issue) *github.GitHubIssueContent {
+			comments, err := agent.githubClient.GetIssueComments(ctx, owner, repo, issue)
+			if err != nil {
+				log.Printf("Error ingesting comments for issue #%d: %v", issue.GetNumber(), err)
+				return nil
+			}
+			return &github.GitHubIssueContent{IssueNumber: issue.GetNumber(), Issue: issue, Comments: comments}
+		})
+
+		if err := ctx.Err(); err != nil {
+			return indexed, err
+		}
+
+		var texts []string
+		var ingested []*github.GitHubIssueContent
+		for _, content := range contents {
+			if content != nil {
+				texts = append(texts, formatIssueForEmbedding(content))
+				ingested = append(ingested, content)
+			}
+		}
+		if len(texts) == 0 {
+			continue
+		}
+
+		vectors, err := agent.embedder.Embed(ctx, texts)
+		if err != nil {
+			return indexed, fmt.Errorf("failed to embed issues: %w", err)
+		}
+
+		for i, content := range ingested {
+			vectorIndex.Put(&index.Document{
+				Host:        host,
+				Owner:       owner,
+				Repo:        repo,
+				IssueNumber: content.IssueNumber,
+				Title:       content.Issue.GetTitle(),
+				UpdatedAt:   content.Issue.GetUpdatedAt().Time,
+				Vector:      vectors[i],
+			})
+		}
+		indexed += len(ingested)
+
+		// Save after each batch so that an interrupted run keeps its progress
+		if err := vectorIndex.Save(); err != nil {
+			return indexed, err
+		}
+		log.Printf("Indexed %d/%d issues", start+len(batch), len(outdated))
+	}
+
+	return indexed, nil
+}
+
+// listIssuesToIndex lists the closed issues of the repository matching the index query
+func (agent *SDHAgent) listIssuesToIndex(ctx context.Context, owner, repo string) ([]*gogithub.Issue, error) {
+	if agent.config.IndexQuery == "" {
+		log.Printf("Listing closed issues of %s/%s", owner, repo)
+		return agent.githubClient.ListClosedIssues(ctx, owner, repo)
+	}
+
+	log.Printf("Searching closed issues of %s/%s matching '%s'", owner, repo, agent.config.IndexQuery)
+	issues, err := agent.githubClient.FindIssues(ctx, owner, repo, agent.config.IndexQuery+" is:closed", maxIndexQueryResults)
+	if err != nil {
+		return nil, err
+	}
+	if len(issues) == maxIndexQueryResults {
+		log.Printf("Index query matches %d issues or more, only the first %d are indexed", maxIndexQueryResults, maxIndexQueryResults)
+	}
+	return issues, nil
+}
+
+// findNearestIssues returns the closed issues whose embeddings are closest to the summary of the main issue
+func (agent *SDHAgent) findNearestIssues(ctx context.Context, mainIssue *github.GitHubIssueContent, summary string) ([]*gogithub.Issue, error) {
+	host, owner, repo := agent.config.GitHubHost(), agent.config.GitHubRepoOwner, agent.config.GitHubRepoName
+
+	vectorIndex, err := index.Load(agent.config.IndexPath)
+	if err != nil {
+		return nil, err
+	}
+	if vectorIndex.Len() == 0 {
+		log.Printf("Vector index %s is empty, run the index command first", agent.config.IndexPath)
+		return nil, nil
+	}
+
+	vectors, err := agent.embedder.Embed(ctx, []string{summary})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed issue summary: %w", err)
+	}
+
+	// Ask for one extra neighbour in case the main issue itself is indexed
+	var issues []*gogithub.Issue
+	for _, match := range vectorIndex.Nearest(host, owner, repo, vectors[0], agent.config.IndexNeighbours+1) {
+		if match.Document.IssueNumber == mainIssue.IssueNumber || len(issues) >= agent.config.IndexNeighbours {
+			continue
+		}
+
+		log.Printf("Nearest neighbour: issue #%d (similarity %.3f)", match.Document.IssueNumber, match.Similarity)
+		issue, err := agent.githubClient.GetIssue(ctx, owner, repo, match.Document.IssueNumber)
+		if err != nil {
+			log.Printf("Error fetching issue #%d: %v", match.Document.IssueNumber, err)
+			continue
+		}
+		issues = append(issues, issue)
+	}
+
+	return issues, nil
+}
+
+// formatIssueForEmbedding builds the text embedded for an issue: its title, body and final comments
+func formatIssueForEmbedding(content *github.GitHubIssueContent) string {
+	var textBuilder strings.Builder
+
+	textBuilder.WriteString(content.Issue.GetTitle())
+	textBuilder.WriteString("\n\n")
+	textBuilder.WriteString(content.Issue.GetBody())
+
+	start := max(0, len(content.Comments)-resolutionComments)
+	for _, comment := range content.Comments[start:] {
+		textBuilder.WriteString("\n\n")
+		textBuilder.WriteString(comment.GetBody())
+	}
+
+	text := textBuilder.String()
+	if len(text) > maxEmbeddingChars {
+		text = strings.ToValidUTF8(text[:maxEmbeddingChars], "")
+	}
+
+	return text
+}
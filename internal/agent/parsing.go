@@ -1,28 +1,52 @@
 package agent
 
-import "strings"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
 
-// parseRelevanceResponse extracts relevance and resolution from LLM response
-func parseRelevanceResponse(response string) (bool, string) {
-	// Split the response into sections based on newlines
-	parts := strings.SplitN(response, "\n", 2)
+// relevanceRequiredFields lists the fields that must be present in a relevance analysis
+var relevanceRequiredFields = []string{"relevant", "confidence", "resolution"}
 
-	// Default values
-	relevant := false
-	resolution := ""
+// parseRelevanceResponse extracts the JSON relevance analysis from LLM response and validates it
+func parseRelevanceResponse(response string) (*RelevanceAnalysis, error) {
+	// Tolerate preamble, trailing text and code fences around the JSON object
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("response does not contain a JSON object")
+	}
+	data := []byte(response[start : end+1])
+
+	// Check required fields are present
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("response is not valid JSON: %w", err)
+	}
+	for _, field := range relevanceRequiredFields {
+		if _, ok := fields[field]; !ok {
+			return nil, fmt.Errorf("missing required field %q", field)
+		}
+	}
 
-	// Parse relevance from first line
-	if len(parts) > 0 && strings.HasPrefix(parts[0], "RELEVANT:") {
-		relevant = strings.Contains(strings.ToLower(parts[0]), "true")
+	// Decode into the typed struct, rejecting unexpected fields and types
+	var analysis RelevanceAnalysis
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&analysis); err != nil {
+		return nil, fmt.Errorf("response does not match the expected schema: %w", err)
 	}
 
-	// Parse resolution from second part (which may contain multiple lines)
-	if len(parts) > 1 && strings.HasPrefix(parts[1], "RESOLUTION:") {
-		// Remove the "RESOLUTION:" prefix
-		resolution = strings.TrimSpace(strings.TrimPrefix(parts[1], "RESOLUTION:"))
+	if analysis.Confidence < 0 || analysis.Confidence > 1 {
+		return nil, fmt.Errorf("confidence must be between 0 and 1, got %v", analysis.Confidence)
+	}
+	if analysis.Relevant && strings.TrimSpace(analysis.Resolution) == "" {
+		return nil, fmt.Errorf("resolution must not be empty for a relevant issue")
 	}
 
-	return relevant, resolution
+	return &analysis, nil
 }
 
 // parseSearchQueries extracts individual search queries from LLM response
@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseRelevanceResponse checks the extraction and validation of relevance analyses,
+// whose errors are sent back to the LLM to repair its response
+func TestParseRelevanceResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     *RelevanceAnalysis
+		wantErr  string
+	}{
+		{
+			name:     "plain JSON",
+			response: `{"relevant": false, "confidence": 0.9, "resolution": ""}`,
+			want:     &RelevanceAnalysis{Relevant: false, Confidence: 0.9},
+		},
+		{
+			name: "fenced JSON",
+			response: "```json\n" + `{"relevant": true, "confidence": 0.8, "resolution": "Fixed by raising the timeout",` +
+				` "key_evidence": ["same stack trace"], "fix_references": ["#42"]}` + "\n```",
+			want: &RelevanceAnalysis{
+				Relevant:      true,
+				Confidence:    0.8,
+				Resolution:    "Fixed by raising the timeout",
+				KeyEvidence:   []string{"same stack trace"},
+				FixReferences: []string{"#42"},
+			},
+		},
+		{
+			name:     "prose around JSON",
+			response: `Here is my analysis: {"relevant": true, "confidence": 1, "resolution": "Upgrade to 7.4"} Hope this helps!`,
+			want:     &RelevanceAnalysis{Relevant: true, Confidence: 1, Resolution: "Upgrade to 7.4"},
+		},
+		{
+			name:     "no JSON",
+			response: "The issue is relevant.",
+			wantErr:  "does not contain a JSON object",
+		},
+		{
+			name:     "invalid JSON",
+			response: `{"relevant": true, "confidence": }`,
+			wantErr:  "not valid JSON",
+		},
+		{
+			name:     "missing field",
+			response: `{"relevant": true, "resolution": "Upgrade"}`,
+			wantErr:  `missing required field "confidence"`,
+		},
+		{
+			name:     "unknown field",
+			response: `{"relevant": true, "confidence": 0.5, "resolution": "Upgrade", "severity": "high"}`,
+			wantErr:  "does not match the expected schema",
+		},
+		{
+			name:     "wrong type",
+			response: `{"relevant": "yes", "confidence": 0.5, "resolution": "Upgrade"}`,
+			wantErr:  "does not match the expected schema",
+		},
+		{
+			name:     "confidence above 1",
+			response: `{"relevant": true, "confidence": 85, "resolution": "Upgrade"}`,
+			wantErr:  "confidence must be between 0 and 1",
+		},
+		{
+			name:     "negative confidence",
+			response: `{"relevant": false, "confidence": -0.1, "resolution": ""}`,
+			wantErr:  "confidence must be between 0 and 1",
+		},
+		{
+			name:     "relevant without resolution",
+			response: `{"relevant": true, "confidence": 0.7, "resolution": "  "}`,
+			wantErr:  "resolution must not be empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRelevanceResponse(tt.response)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseRelevanceResponse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRelevanceResponse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRelevanceResponse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,16 +1,32 @@
 package agent
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
 
+	"sdh-agent/internal/config"
 	"sdh-agent/internal/github"
+	"sdh-agent/internal/llm"
 	"sdh-agent/internal/prompts"
 )
 
-// generateReport creates the final report
-func (agent *SDHAgent) generateReport(mainIssue *github.GitHubIssueContent, summary string, analysisResults []AnalyzisResult) (string, error) {
+const (
+	// reportMarker is a hidden marker identifying comments posted by the agent
+	reportMarker = "<!-- sdh-agent:report -->"
+	// historyStartMarker and historyEndMarker delimit the revision history section of a report comment
+	historyStartMarker = "<!-- sdh-agent:history -->"
+	historyEndMarker   = "<!-- /sdh-agent:history -->"
+
+	// maxRevisions is the number of revisions kept in the revision history
+	maxRevisions = 5
+
+	reportTimestampFormat = "2006-01-02 15:04:05 UTC"
+)
+
+// generateReport creates the final report, streaming its text to `onText` unless it is nil
+func (agent *SDHAgent) generateReport(ctx context.Context, mainIssue *github.GitHubIssueContent, summary string, analysisResults []AnalyzisResult, onText func(text string)) (string, error) {
 	var messages []string
 
 	// Create a prompt for report generation
@@ -25,13 +41,16 @@ func (agent *SDHAgent) generateReport(mainIssue *github.GitHubIssueContent, summ
 	analysisMessages := formatAnalyzisResults(analysisResults)
 	messages = append(messages, analysisMessages...)
 
-	report, err := agent.llmClient.GenerateText(messages)
+	// The relevance checks stop short of the budget share kept for the report, but if their concurrent
+	// calls overran the whole budget, the report is refused with llm.ErrBudgetExceeded like any other call
+	response, err := agent.stream(ctx, config.StageReport, llm.Request{Messages: llm.UserMessages(messages...)}, onText)
 	if err != nil {
 		return "", err
 	}
+	report := response.Text
 
 	// Add header and footer
-	finalReport := formatReportWrapper(mainIssue.IssueNumber, time.Now().Format("2006-01-02 15:04:05 UTC"), report)
+	finalReport := formatReportWrapper(mainIssue.IssueNumber, time.Now().UTC().Format(reportTimestampFormat), report)
 
 	return finalReport, nil
 }
@@ -60,7 +79,14 @@ func formatAnalyzisResults(analysisResults []AnalyzisResult) []string {
 		var analyzisBuilder strings.Builder
 
 		// Add analysis data for each similar issue
-		analyzisBuilder.WriteString(fmt.Sprintf("Issue #%d:\n%s\n", result.IssueContent.IssueNumber, result.Resolution))
+		analyzisBuilder.WriteString(fmt.Sprintf("Issue #%d (relevance confidence: %.2f):\n%s\n", result.IssueContent.IssueNumber, result.Confidence, result.Resolution))
+
+		if len(result.KeyEvidence) > 0 {
+			analyzisBuilder.WriteString(fmt.Sprintf("\nKey evidence:\n- %s\n", strings.Join(result.KeyEvidence, "\n- ")))
+		}
+		if len(result.FixReferences) > 0 {
+			analyzisBuilder.WriteString(fmt.Sprintf("\nFix references:\n- %s\n", strings.Join(result.FixReferences, "\n- ")))
+		}
 
 		// Add context about where this comment fits in the sequence
 		if i < len(analysisResults)-1 {
@@ -78,7 +104,8 @@ func formatAnalyzisResults(analysisResults []AnalyzisResult) []string {
 
 // FormatReportWrapper adds header and footer to the generated report
 func formatReportWrapper(issueNumber int, timestamp, reportContent string) string {
-	return fmt.Sprintf(`## AI Agent Analysis Report for SDH Issue #%d
+	return fmt.Sprintf(`%s
+## AI Agent Analysis Report for SDH Issue #%d
 
 *Generated on %s*
 
@@ -86,7 +113,48 @@ func formatReportWrapper(issueNumber int, timestamp, reportContent string) strin
 
 ---
 *This report was automatically generated by the SDH AI Agent based on analysis of similar issues.*`,
+		reportMarker,
 		issueNumber,
 		timestamp,
 		reportContent)
 }
+
+// formatRevisionHistory appends a collapsible revision history section to the report,
+// keeping at most `maxRevisions` entries with the most recent first
+func formatRevisionHistory(report string, revisions []string) string {
+	if len(revisions) > maxRevisions {
+		revisions = revisions[:maxRevisions]
+	}
+
+	var historyBuilder strings.Builder
+	historyBuilder.WriteString(report)
+	historyBuilder.WriteString("\n\n")
+	historyBuilder.WriteString(historyStartMarker)
+	historyBuilder.WriteString("\n<details>\n<summary>Revision history</summary>\n\n")
+	for _, revision := range revisions {
+		historyBuilder.WriteString(fmt.Sprintf("- %s\n", revision))
+	}
+	historyBuilder.WriteString("\n</details>\n")
+	historyBuilder.WriteString(historyEndMarker)
+
+	return historyBuilder.String()
+}
+
+// parseRevisionHistory extracts the revision entries from a previously posted report comment
+func parseRevisionHistory(body string) []string {
+	start := strings.Index(body, historyStartMarker)
+	end := strings.Index(body, historyEndMarker)
+	if start < 0 || end < start {
+		return nil
+	}
+
+	var revisions []string
+	for _, line := range strings.Split(body[start+len(historyStartMarker):end], "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "- ") {
+			revisions = append(revisions, strings.TrimPrefix(line, "- "))
+		}
+	}
+
+	return revisions
+}
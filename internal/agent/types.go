@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"sdh-agent/internal/cache"
 	"sdh-agent/internal/config"
 	"sdh-agent/internal/github"
 	"sdh-agent/internal/llm"
@@ -8,13 +9,38 @@ import (
 
 // SDHAgent is the main agent structure
 type SDHAgent struct {
-	config       config.Configuration
-	llmClient    llm.Client
+	config config.Configuration
+	// llmClients holds one LLM client per pipeline stage
+	llmClients   map[string]llm.Client
+	embedder     llm.Embedder
 	githubClient *github.Client
+	// cache is closed with the agent, nil if caching is disabled
+	cache *cache.Cache
 }
 
 // AnalyzisResult represents the analysis of a similar issue
 type AnalyzisResult struct {
 	IssueContent *github.GitHubIssueContent
-	Resolution   string
+	RelevanceAnalysis
+}
+
+// RelevanceAnalysis is the structured answer of the LLM to a relevance analysis prompt
+type RelevanceAnalysis struct {
+	Relevant bool `json:"relevant"`
+	// Confidence is the LLM's confidence in its answer, between 0 and 1
+	Confidence float64 `json:"confidence"`
+	// Resolution summarizes how the similar issue was resolved and what insights it provides
+	Resolution string `json:"resolution"`
+	// KeyEvidence lists the facts shared by both issues that support the answer
+	KeyEvidence []string `json:"key_evidence"`
+	// FixReferences lists PRs, commits, docs or issues referenced by the fix
+	FixReferences []string `json:"fix_references"`
+}
+
+// ReportComment represents a report ready to be posted on an SDH issue
+type ReportComment struct {
+	IssueNumber int
+	// CommentID is the ID of the agent's previous report comment, or 0 if a new comment will be created
+	CommentID int64
+	Body      string
 }
@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/go-github/v63/github"
+	bolt "go.etcd.io/bbolt"
+)
+
+// issuesBucket is the bucket holding cached issues
+var issuesBucket = []byte("issues")
+
+// Cache is a persistent on-disk cache of GitHub issues and their comments
+type Cache struct {
+	db *bolt.DB
+}
+
+// IssueEntry is a cached issue along with its comments
+type IssueEntry struct {
+	// UpdatedAt is the issue's `updated_at` when it was cached, used for invalidation
+	UpdatedAt time.Time `json:"updated_at"`
+	// MaxComments is the cap on the number of comments fetched when the issue was cached
+	MaxComments int                    `json:"max_comments"`
+	Issue       *github.Issue          `json:"issue"`
+	Comments    []*github.IssueComment `json:"comments"`
+}
+
+// Open opens the cache database at `path`, creating it if needed
+func Open(path string) (*Cache, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	// Fail fast instead of blocking if another process holds the database lock
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache database %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(issuesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize cache database: %w", err)
+	}
+
+	return &Cache{db: db}, nil
+}
+
+// Close closes the cache database
+func (c *Cache) Close() error {
+	return c.db.Close()
+}
+
+// GetIssue returns the cached entry for an issue of the GitHub instance at `host` if it is still up to date
+// with `updatedAt` and its comments were fetched with the same `maxComments` cap
+func (c *Cache) GetIssue(host, owner, repo string, issueNumber int, updatedAt time.Time, maxComments int) (*IssueEntry, bool) {
+	var entry *IssueEntry
+
+	err := c.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(issuesBucket).Get(issueKey(host, owner, repo, issueNumber))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &entry)
+	})
+	if err != nil || entry == nil || !entry.UpdatedAt.Equal(updatedAt) || entry.MaxComments != maxComments {
+		return nil, false
+	}
+
+	return entry, true
+}
+
+// PutIssue stores an issue of the GitHub instance at `host` and its comments in the cache, replacing any previous entry
+func (c *Cache) PutIssue(host, owner, repo string, issueNumber int, entry *IssueEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(issuesBucket).Put(issueKey(host, owner, repo, issueNumber), data)
+	})
+}
+
+// issueKey builds the cache key of an issue, including the API host so that the issues
+// of different GitHub instances (e.g. github.com and GitHub Enterprise Server) are kept apart
+func issueKey(host, owner, repo string, issueNumber int) []byte {
+	return []byte(fmt.Sprintf("%s/%s/%s#%d", host, owner, repo, issueNumber))
+}
@@ -2,48 +2,294 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// Pipeline stages whose LLM settings can be overridden individually
+const (
+	StageSummary   = "summary"
+	StageQueries   = "queries"
+	StageRelevance = "relevance"
+	StageReport    = "report"
+)
+
+// maxTemperatures is the highest sampling temperature accepted by the API of each provider,
+// other providers are assumed to accept up to `defaultMaxTemperature` like OpenAI
+var maxTemperatures = map[string]float64{
+	"anthropic": 1,
+	"openai":    2,
+}
+
+const defaultMaxTemperature = 2.0
+
+// Retrieval modes used to find similar issues
+const (
+	// RetrievalSearch uses LLM-generated GitHub search queries only
+	RetrievalSearch = "search"
+	// RetrievalHybrid combines search results with nearest neighbours from the local vector index
+	RetrievalHybrid = "hybrid"
+)
+
+// DefaultConcurrency is the default number of parallel GitHub or LLM calls
+const DefaultConcurrency = 4
+
+// Stages lists all pipeline stages in execution order
+var Stages = []string{StageSummary, StageQueries, StageRelevance, StageReport}
+
+// LlmSettings holds the generation settings used for LLM calls.
+// Zero values mean the provider default is used.
+type LlmSettings struct {
+	Model       string
+	MaxTokens   int
+	Temperature *float64
+}
+
 // Configuration holds all necessary API configurations
 type Configuration struct {
 	GitHubToken     string
 	GitHubRepoOwner string
 	GitHubRepoName  string
 	LlmApiKey       string
+
+	// LLM provider selection ("anthropic" by default, or "openai" for OpenAI-compatible servers)
+	LlmProvider string
+	LlmBaseURL  string
+
+	// First delay between retries of rate-limited or failed LLM requests (0 means use the provider default)
+	LlmRetryBackoff time.Duration
+
+	// Default LLM generation settings, and per-stage overrides keyed by stage name
+	LlmSettings      LlmSettings
+	LlmStageSettings map[string]LlmSettings
+
+	// GitHub App used instead of GITHUB_TOKEN so that the agent acts as a bot: app ID,
+	// installation ID and PEM-encoded private key
+	GitHubAppID             int64
+	GitHubAppInstallationID int64
+	GitHubAppPrivateKey     string
+
+	// GitHub Enterprise Server API and upload URLs (e.g. https://github.example.com/api/v3/),
+	// empty to use github.com. The upload URL defaults to the API URL.
+	GitHubBaseURL   string
+	GitHubUploadURL string
+
+	// Caps on paginated GitHub requests (0 means use the client default)
+	GitHubMaxComments      int
+	GitHubMaxSearchResults int
+
+	// LLM budget of a single issue analysis in US dollars and tokens (0 means unlimited).
+	// Relevance checks stop early as the budget runs out, and LLM calls fail once it is exhausted.
+	MaxRunCost   float64
+	MaxRunTokens int
+
+	// Maximum number of GitHub or LLM calls run in parallel
+	Concurrency int
+
+	// Location of the on-disk issue cache, and whether it is used at all
+	CachePath     string
+	CacheDisabled bool
+
+	// OpenAI-compatible embeddings API used to build and query the vector index
+	EmbeddingApiKey  string
+	EmbeddingBaseURL string
+	EmbeddingModel   string
+
+	// Similar issue retrieval ("search" or "hybrid"), location of the vector index,
+	// number of nearest neighbours added to the search results in hybrid mode
+	// and GitHub search query restricting the indexed issues (empty means all closed issues)
+	RetrievalMode   string
+	IndexPath       string
+	IndexNeighbours int
+	IndexQuery      string
+
+	// Webhook server settings: listen address, secret used to verify the X-Hub-Signature-256
+	// header, labels an issue must have one of to be analyzed (empty means all) and number of workers
+	ServerAddr     string
+	WebhookSecret  string
+	WebhookLabels  []string
+	WebhookWorkers int
+
+	// Who may trigger the agent with slash commands in issue comments: GitHub logins, organizations
+	// and "org/team-slug" teams. When all are empty, repository owners, members and collaborators may.
+	SlashCommandUsers []string
+	SlashCommandOrgs  []string
+	SlashCommandTeams []string
+
+	// Location of the durable job queue and number of attempts of a job before it fails
+	QueuePath        string
+	QueueMaxAttempts int
 }
 
-// Load configuration from environment variables
+// Load configuration from environment variables and validate it
 // It looks for a .env file for local development
 func Load() (*Configuration, error) {
+	config, err := Read()
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the loaded configuration
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Read loads configuration from environment variables without validating it,
+// so that callers can apply overrides (e.g. command line flags) before validation
+func Read() (*Configuration, error) {
 	// Load .env file if it exists
 	_ = godotenv.Load()
 
 	// Create config with values from environment
 	config := &Configuration{
-		GitHubToken:     os.Getenv("GITHUB_TOKEN"),
-		LlmApiKey:       os.Getenv("LLM_API_KEY"),
-		GitHubRepoOwner: os.Getenv("GITHUB_REPO_OWNER"),
-		GitHubRepoName:  os.Getenv("GITHUB_REPO_NAME"),
+		GitHubToken:      os.Getenv("GITHUB_TOKEN"),
+		LlmApiKey:        os.Getenv("LLM_API_KEY"),
+		GitHubRepoOwner:  os.Getenv("GITHUB_REPO_OWNER"),
+		GitHubRepoName:   os.Getenv("GITHUB_REPO_NAME"),
+		GitHubBaseURL:    os.Getenv("GITHUB_BASE_URL"),
+		GitHubUploadURL:  os.Getenv("GITHUB_UPLOAD_URL"),
+		LlmProvider:      strings.ToLower(os.Getenv("LLM_PROVIDER")),
+		LlmBaseURL:       os.Getenv("LLM_BASE_URL"),
+		CachePath:        os.Getenv("CACHE_PATH"),
+		CacheDisabled:    strings.EqualFold(os.Getenv("CACHE_DISABLED"), "true"),
+		EmbeddingApiKey:  os.Getenv("EMBEDDING_API_KEY"),
+		EmbeddingBaseURL: os.Getenv("EMBEDDING_BASE_URL"),
+		EmbeddingModel:   os.Getenv("EMBEDDING_MODEL"),
+		RetrievalMode:    strings.ToLower(os.Getenv("RETRIEVAL_MODE")),
+		IndexPath:        os.Getenv("INDEX_PATH"),
+		IndexQuery:       os.Getenv("INDEX_QUERY"),
+		ServerAddr:       os.Getenv("SERVER_ADDR"),
+		WebhookSecret:    os.Getenv("WEBHOOK_SECRET"),
+		WebhookLabels:    getEnvList("WEBHOOK_LABELS"),
+		QueuePath:        os.Getenv("QUEUE_PATH"),
+
+		SlashCommandUsers: getEnvList("SLASH_COMMAND_USERS"),
+		SlashCommandOrgs:  getEnvList("SLASH_COMMAND_ORGS"),
+		SlashCommandTeams: getEnvList("SLASH_COMMAND_TEAMS"),
+	}
+	if config.QueuePath == "" {
+		config.QueuePath = defaultDataPath("queue.db")
+	}
+	if config.ServerAddr == "" {
+		config.ServerAddr = ":8080"
+	}
+	if config.CachePath == "" {
+		config.CachePath = defaultDataPath("cache.db")
+	}
+	if config.EmbeddingModel == "" {
+		config.EmbeddingModel = "text-embedding-3-small"
+	}
+	if config.RetrievalMode == "" {
+		config.RetrievalMode = RetrievalSearch
+	}
+	if config.IndexPath == "" {
+		config.IndexPath = defaultDataPath("index.json")
+	}
+	if config.LlmProvider == "" {
+		config.LlmProvider = "anthropic"
 	}
 
-	// Validate the loaded configuration
-	if err := config.Validate(); err != nil {
+	// Parse optional numeric settings
+	var err error
+	if config.GitHubAppID, err = getEnvInt64("GITHUB_APP_ID"); err != nil {
+		return nil, err
+	}
+	if config.GitHubAppInstallationID, err = getEnvInt64("GITHUB_APP_INSTALLATION_ID"); err != nil {
 		return nil, err
 	}
 
+	// The app private key is given inline or as a path to the .pem file downloaded from GitHub
+	config.GitHubAppPrivateKey = os.Getenv("GITHUB_APP_PRIVATE_KEY")
+	if keyPath := os.Getenv("GITHUB_APP_PRIVATE_KEY_PATH"); keyPath != "" && config.GitHubAppPrivateKey == "" {
+		key, err := os.ReadFile(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read GITHUB_APP_PRIVATE_KEY_PATH: %w", err)
+		}
+		config.GitHubAppPrivateKey = string(key)
+	}
+
+	if config.GitHubMaxComments, err = getEnvInt("GITHUB_MAX_COMMENTS"); err != nil {
+		return nil, err
+	}
+	if config.GitHubMaxSearchResults, err = getEnvInt("GITHUB_MAX_SEARCH_RESULTS"); err != nil {
+		return nil, err
+	}
+
+	if config.Concurrency, err = getEnvInt("AGENT_CONCURRENCY"); err != nil {
+		return nil, err
+	}
+	if config.Concurrency == 0 {
+		config.Concurrency = DefaultConcurrency
+	}
+	if config.IndexNeighbours, err = getEnvInt("INDEX_NEIGHBOURS"); err != nil {
+		return nil, err
+	}
+	if config.IndexNeighbours == 0 {
+		config.IndexNeighbours = 10
+	}
+	if config.WebhookWorkers, err = getEnvInt("WEBHOOK_WORKERS"); err != nil {
+		return nil, err
+	}
+	if config.WebhookWorkers == 0 {
+		config.WebhookWorkers = 1
+	}
+	if config.QueueMaxAttempts, err = getEnvInt("QUEUE_MAX_ATTEMPTS"); err != nil {
+		return nil, err
+	}
+	if config.QueueMaxAttempts == 0 {
+		config.QueueMaxAttempts = 5
+	}
+
+	if config.LlmRetryBackoff, err = getEnvDuration("LLM_RETRY_BACKOFF"); err != nil {
+		return nil, err
+	}
+
+	maxRunCost, err := getEnvFloat("MAX_RUN_COST")
+	if err != nil {
+		return nil, err
+	}
+	if maxRunCost != nil {
+		config.MaxRunCost = *maxRunCost
+	}
+	if config.MaxRunTokens, err = getEnvInt("MAX_RUN_TOKENS"); err != nil {
+		return nil, err
+	}
+
+	// Parse LLM generation settings and their per-stage overrides
+	if config.LlmSettings, err = loadLlmSettings("LLM_"); err != nil {
+		return nil, err
+	}
+	config.LlmStageSettings = make(map[string]LlmSettings, len(Stages))
+	for _, stage := range Stages {
+		if config.LlmStageSettings[stage], err = loadLlmSettings("LLM_" + strings.ToUpper(stage) + "_"); err != nil {
+			return nil, err
+		}
+	}
+
 	return config, nil
 }
 
 // Validate ensures all required configuration values are set
 func (c *Configuration) Validate() error {
-	if c.GitHubToken == "" {
+	if c.UsesGitHubApp() {
+		if c.GitHubAppID <= 0 || c.GitHubAppInstallationID <= 0 || c.GitHubAppPrivateKey == "" {
+			return fmt.Errorf("GitHub App authentication requires GITHUB_APP_ID, GITHUB_APP_INSTALLATION_ID and GITHUB_APP_PRIVATE_KEY (or GITHUB_APP_PRIVATE_KEY_PATH)")
+		}
+	} else if c.GitHubToken == "" {
 		return fmt.Errorf("GITHUB_TOKEN environment variable not set")
 	}
 
-	if c.LlmApiKey == "" {
+	// OpenAI-compatible servers (e.g. a local Ollama) may not require an API key
+	if c.LlmApiKey == "" && c.LlmProvider != "openai" {
 		return fmt.Errorf("LLM_API_KEY environment variable not set")
 	}
 
@@ -55,5 +301,220 @@ func (c *Configuration) Validate() error {
 		return fmt.Errorf("GITHUB_REPO_NAME environment variable not set")
 	}
 
+	if c.GitHubUploadURL != "" && c.GitHubBaseURL == "" {
+		return fmt.Errorf("GITHUB_UPLOAD_URL requires GITHUB_BASE_URL to be set")
+	}
+
+	if c.GitHubBaseURL != "" {
+		if u, err := url.Parse(c.GitHubBaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("GITHUB_BASE_URL must be an absolute URL, got %q", c.GitHubBaseURL)
+		}
+	}
+
+	if c.GitHubMaxComments < 0 {
+		return fmt.Errorf("GITHUB_MAX_COMMENTS must not be negative")
+	}
+
+	if c.GitHubMaxSearchResults < 0 {
+		return fmt.Errorf("GITHUB_MAX_SEARCH_RESULTS must not be negative")
+	}
+
+	if c.LlmRetryBackoff < 0 {
+		return fmt.Errorf("LLM_RETRY_BACKOFF must not be negative")
+	}
+
+	if c.MaxRunCost < 0 {
+		return fmt.Errorf("MAX_RUN_COST must not be negative")
+	}
+
+	if c.MaxRunTokens < 0 {
+		return fmt.Errorf("MAX_RUN_TOKENS must not be negative")
+	}
+
+	if c.Concurrency < 0 {
+		return fmt.Errorf("AGENT_CONCURRENCY must not be negative")
+	}
+
+	if c.RetrievalMode != RetrievalSearch && c.RetrievalMode != RetrievalHybrid {
+		return fmt.Errorf("RETRIEVAL_MODE must be %q or %q", RetrievalSearch, RetrievalHybrid)
+	}
+
+	if c.IndexNeighbours < 0 {
+		return fmt.Errorf("INDEX_NEIGHBOURS must not be negative")
+	}
+
+	if c.WebhookWorkers < 0 {
+		return fmt.Errorf("WEBHOOK_WORKERS must not be negative")
+	}
+
+	if c.QueueMaxAttempts < 0 {
+		return fmt.Errorf("QUEUE_MAX_ATTEMPTS must not be negative")
+	}
+
+	for _, team := range c.SlashCommandTeams {
+		if org, slug, ok := strings.Cut(team, "/"); !ok || org == "" || slug == "" {
+			return fmt.Errorf("SLASH_COMMAND_TEAMS entry %q must have the form org/team-slug", team)
+		}
+	}
+
+	maxTemperature, ok := maxTemperatures[c.LlmProvider]
+	if !ok {
+		maxTemperature = defaultMaxTemperature
+	}
+
+	for _, stage := range Stages {
+		settings := c.StageSettings(stage)
+		if settings.MaxTokens < 0 {
+			return fmt.Errorf("max tokens for the %s stage must not be negative", stage)
+		}
+		if settings.Temperature != nil && (*settings.Temperature < 0 || *settings.Temperature > maxTemperature) {
+			return fmt.Errorf("temperature for the %s stage must be between 0 and %g with the %s provider", stage, maxTemperature, c.LlmProvider)
+		}
+	}
+
 	return nil
 }
+
+// SetRepo overrides the GitHub repository from an "owner/name" string
+func (c *Configuration) SetRepo(fullName string) error {
+	owner, name, ok := strings.Cut(fullName, "/")
+	if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid repository %q, expected owner/name", fullName)
+	}
+
+	c.GitHubRepoOwner = owner
+	c.GitHubRepoName = name
+	return nil
+}
+
+// UsesGitHubApp reports whether the agent authenticates as a GitHub App rather than with GITHUB_TOKEN
+func (c *Configuration) UsesGitHubApp() bool {
+	return c.GitHubAppID != 0 || c.GitHubAppInstallationID != 0 || c.GitHubAppPrivateKey != ""
+}
+
+// GitHubHost returns the host name of the configured GitHub instance, e.g. github.com
+func (c *Configuration) GitHubHost() string {
+	if c.GitHubBaseURL == "" {
+		return "github.com"
+	}
+
+	u, err := url.Parse(c.GitHubBaseURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// StageSettings returns the LLM settings for a pipeline stage, falling back
+// to the default settings for anything the stage does not override
+func (c *Configuration) StageSettings(stage string) LlmSettings {
+	settings := c.LlmSettings
+	override := c.LlmStageSettings[stage]
+
+	if override.Model != "" {
+		settings.Model = override.Model
+	}
+	if override.MaxTokens != 0 {
+		settings.MaxTokens = override.MaxTokens
+	}
+	if override.Temperature != nil {
+		settings.Temperature = override.Temperature
+	}
+
+	return settings
+}
+
+// loadLlmSettings reads the MODEL, MAX_TOKENS and TEMPERATURE environment variables with the given prefix
+func loadLlmSettings(prefix string) (LlmSettings, error) {
+	settings := LlmSettings{Model: os.Getenv(prefix + "MODEL")}
+
+	var err error
+	if settings.MaxTokens, err = getEnvInt(prefix + "MAX_TOKENS"); err != nil {
+		return LlmSettings{}, err
+	}
+	if settings.Temperature, err = getEnvFloat(prefix + "TEMPERATURE"); err != nil {
+		return LlmSettings{}, err
+	}
+
+	return settings, nil
+}
+
+// defaultDataPath returns the default location of a data file in the user cache directory
+func defaultDataPath(name string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "sdh-agent", name)
+}
+
+// getEnvInt reads an optional integer environment variable, returning 0 if it is not set
+func getEnvInt(key string) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s environment variable must be an integer: %w", key, err)
+	}
+
+	return number, nil
+}
+
+// getEnvInt64 reads an optional 64-bit integer environment variable, returning 0 if it is not set
+func getEnvInt64(key string) (int64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s environment variable must be an integer: %w", key, err)
+	}
+
+	return number, nil
+}
+
+// getEnvList reads an optional comma-separated environment variable, ignoring empty items
+func getEnvList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnvDuration reads an optional duration environment variable (e.g. "15s"), returning 0 if it is not set
+func getEnvDuration(key string) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s environment variable must be a duration (e.g. 15s): %w", key, err)
+	}
+
+	return duration, nil
+}
+
+// getEnvFloat reads an optional float environment variable, returning nil if it is not set
+func getEnvFloat(key string) (*float64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s environment variable must be a number: %w", key, err)
+	}
+
+	return &number, nil
+}
@@ -0,0 +1,172 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v63/github"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// jwtLifetime is the validity of app JWTs, GitHub accepts at most 10 minutes
+	jwtLifetime = 9 * time.Minute
+	// jwtClockSkew backdates the JWT issue time to tolerate clock drift with GitHub
+	jwtClockSkew = time.Minute
+	// tokenRefreshMargin is how long before expiry an installation token is refreshed
+	tokenRefreshMargin = 5 * time.Minute
+	// tokenRequestTimeout bounds the exchange of a JWT for an installation token
+	tokenRequestTimeout = 30 * time.Second
+)
+
+// AppCredentials identifies a GitHub App installation used instead of a personal access token
+type AppCredentials struct {
+	AppID          int64
+	InstallationID int64
+	// PrivateKey is the PEM-encoded private key of the app
+	PrivateKey []byte
+}
+
+// appTokenSource mints installation access tokens of a GitHub App
+type appTokenSource struct {
+	appID          int64
+	installationID int64
+	key            *rsa.PrivateKey
+	// apps exchanges JWTs for installation tokens
+	apps *github.AppsService
+}
+
+// newAppTokenSource returns a source of installation tokens of the app
+func newAppTokenSource(creds AppCredentials, baseURL, uploadURL string) (*appTokenSource, error) {
+	key, err := parsePrivateKey(creds.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	source := &appTokenSource{
+		appID:          creds.AppID,
+		installationID: creds.InstallationID,
+		key:            key,
+	}
+
+	// The app endpoints authenticate with the JWT rather than an installation token
+	client := github.NewClient(&http.Client{Transport: &jwtTransport{source: source}})
+	if baseURL != "" {
+		if client, err = client.WithEnterpriseURLs(baseURL, uploadURL); err != nil {
+			return nil, fmt.Errorf("failed to configure GitHub Enterprise URLs: %w", err)
+		}
+	}
+	source.apps = client.Apps
+
+	return source, nil
+}
+
+// reusable returns a token source reusing installation tokens until shortly before they expire
+func (s *appTokenSource) reusable() oauth2.TokenSource {
+	return oauth2.ReuseTokenSourceWithExpiry(nil, s, tokenRefreshMargin)
+}
+
+// botLogin returns the login of the bot user the app acts as, e.g. "sdh-agent[bot]"
+func (s *appTokenSource) botLogin(ctx context.Context) (string, error) {
+	app, _, err := s.apps.Get(ctx, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to get GitHub App %d: %w", s.appID, err)
+	}
+	return app.GetSlug() + "[bot]", nil
+}
+
+// Token exchanges a freshly minted JWT for an installation access token
+func (s *appTokenSource) Token() (*oauth2.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tokenRequestTimeout)
+	defer cancel()
+
+	token, _, err := s.apps.CreateInstallationToken(ctx, s.installationID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create installation token for GitHub App %d: %w", s.appID, err)
+	}
+
+	return &oauth2.Token{
+		AccessToken: token.GetToken(),
+		Expiry:      token.GetExpiresAt().Time,
+	}, nil
+}
+
+// jwt mints a JSON Web Token authenticating as the GitHub App
+func (s *appTokenSource) jwt() (string, error) {
+	now := time.Now()
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	claims := map[string]any{
+		"iat": now.Add(-jwtClockSkew).Unix(),
+		"exp": now.Add(jwtLifetime).Unix(),
+		"iss": strconv.FormatInt(s.appID, 10),
+	}
+
+	var segments [2]string
+	for i, part := range []any{header, claims} {
+		data, err := json.Marshal(part)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode JWT: %w", err)
+		}
+		segments[i] = base64.RawURLEncoding.EncodeToString(data)
+	}
+	signingInput := segments[0] + "." + segments[1]
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %w", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// jwtTransport authenticates requests with a GitHub App JWT
+type jwtTransport struct {
+	source *appTokenSource
+}
+
+// RoundTrip adds a freshly minted JWT to the request
+func (t *jwtTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.source.jwt()
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// parsePrivateKey parses a PEM-encoded RSA private key in PKCS#1 or PKCS#8 form
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: %w", err)
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: not an RSA key")
+	}
+	return key, nil
+}
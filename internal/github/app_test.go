@@ -0,0 +1,186 @@
+package github
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestKey generates an RSA key and returns it along with its PKCS#1 and PKCS#8 PEM encodings
+func newTestKey(t *testing.T) (*rsa.PrivateKey, []byte, []byte) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() error = %v", err)
+	}
+
+	return key,
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+}
+
+// verifyJWT checks the RS256 signature of a JWT against `key` and returns its claims
+func verifyJWT(t *testing.T, token string, key *rsa.PublicKey) map[string]any {
+	t.Helper()
+
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		t.Fatalf("JWT has %d segments, want 3", len(segments))
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(segments[2])
+	if err != nil {
+		t.Fatalf("failed to decode JWT signature: %v", err)
+	}
+	digest := sha256.Sum256([]byte(segments[0] + "." + segments[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		t.Fatalf("invalid JWT signature: %v", err)
+	}
+
+	var header map[string]any
+	decodeSegment(t, segments[0], &header)
+	if header["alg"] != "RS256" {
+		t.Errorf("JWT alg = %v, want RS256", header["alg"])
+	}
+
+	var claims map[string]any
+	decodeSegment(t, segments[1], &claims)
+	return claims
+}
+
+// decodeSegment decodes a base64url-encoded JSON segment of a JWT
+func decodeSegment(t *testing.T, segment string, v any) {
+	t.Helper()
+
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		t.Fatalf("failed to decode JWT segment: %v", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("failed to parse JWT segment: %v", err)
+	}
+}
+
+// TestParsePrivateKey checks that PKCS#1 and PKCS#8 keys are accepted and that other data is rejected
+func TestParsePrivateKey(t *testing.T) {
+	key, pkcs1, pkcs8 := newTestKey(t)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{name: "PKCS#1", data: pkcs1},
+		{name: "PKCS#8", data: pkcs8},
+		{name: "not PEM", data: []byte("not a key"), wantErr: true},
+		{name: "invalid key", data: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("garbage")}), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parsePrivateKey(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parsePrivateKey() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePrivateKey() error = %v", err)
+			}
+			if !parsed.Equal(key) {
+				t.Errorf("parsePrivateKey() returned a different key")
+			}
+		})
+	}
+}
+
+// TestAppJWT checks that app JWTs are signed with the app key and carry the app ID and validity claims
+func TestAppJWT(t *testing.T) {
+	key, _, _ := newTestKey(t)
+	source := &appTokenSource{appID: 12345, key: key}
+
+	now := time.Now()
+	token, err := source.jwt()
+	if err != nil {
+		t.Fatalf("jwt() error = %v", err)
+	}
+
+	claims := verifyJWT(t, token, &key.PublicKey)
+
+	if claims["iss"] != "12345" {
+		t.Errorf("iss = %v, want %q", claims["iss"], "12345")
+	}
+
+	iat := time.Unix(int64(claims["iat"].(float64)), 0)
+	if got, want := now.Sub(iat), jwtClockSkew; got < want-time.Second || got > want+time.Second {
+		t.Errorf("iat is %s before now, want %s", got, want)
+	}
+
+	exp := time.Unix(int64(claims["exp"].(float64)), 0)
+	if got := exp.Sub(iat); got > 10*time.Minute {
+		t.Errorf("JWT is valid for %s, GitHub accepts at most 10 minutes", got)
+	}
+	if !exp.After(now) {
+		t.Errorf("exp = %s, want after now", exp)
+	}
+}
+
+// TestAppToken checks that installation tokens are requested with the app JWT and expire when GitHub says
+func TestAppToken(t *testing.T) {
+	key, pkcs1, _ := newTestKey(t)
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v3/app/installations/678/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			t.Errorf("Authorization header = %q, want a bearer token", r.Header.Get("Authorization"))
+		} else if claims := verifyJWT(t, token, &key.PublicKey); claims["iss"] != "12345" {
+			t.Errorf("iss = %v, want %q", claims["iss"], "12345")
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"token": "ghs_installation", "expires_at": expiresAt.Format(time.RFC3339)})
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		http.NotFound(w, r)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	source, err := newAppTokenSource(AppCredentials{AppID: 12345, InstallationID: 678, PrivateKey: pkcs1}, server.URL, server.URL)
+	if err != nil {
+		t.Fatalf("newAppTokenSource() error = %v", err)
+	}
+
+	token, err := source.Token()
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+
+	if token.AccessToken != "ghs_installation" {
+		t.Errorf("AccessToken = %q, want %q", token.AccessToken, "ghs_installation")
+	}
+	if !token.Expiry.Equal(expiresAt) {
+		t.Errorf("Expiry = %s, want %s", token.Expiry, expiresAt)
+	}
+}
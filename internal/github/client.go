@@ -1,21 +1,30 @@
 package github
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"sdh-agent/internal/cache"
 
 	"github.com/google/go-github/v63/github"
 )
 
-// GetIssueContent fetches an issue and all its comments
-func (c *Client) GetIssueContent(owner, repo string, issueNumber int) (*GitHubIssueContent, error) {
+// maxPerPage is the largest page size accepted by the GitHub REST API
+const maxPerPage = 100
+
+// GetIssueContent fetches an issue and all its comments, reusing cached comments if the issue is unchanged
+func (c *Client) GetIssueContent(ctx context.Context, owner, repo string, issueNumber int) (*GitHubIssueContent, error) {
 	// Fetch the issue
-	issue, _, err := c.client.Issues.Get(c.ctx, owner, repo, issueNumber)
+	issue, err := c.GetIssue(ctx, owner, repo, issueNumber)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get issue: %w", err)
+		return nil, err
 	}
 
 	// Fetch comments
-	comments, err := c.GetIssueComments(owner, repo, issue)
+	comments, err := c.GetIssueComments(ctx, owner, repo, issue)
 	if err != nil {
 		return nil, err
 	}
@@ -27,43 +36,281 @@ func (c *Client) GetIssueContent(owner, repo string, issueNumber int) (*GitHubIs
 	}, nil
 }
 
-// GetIssueContent fetches an issue and all its comments
-func (c *Client) GetIssueComments(owner, repo string, issue *github.Issue) ([]*github.IssueComment, error) {
+// GetIssue fetches a single issue without its comments
+func (c *Client) GetIssue(ctx context.Context, owner, repo string, issueNumber int) (*github.Issue, error) {
+	issue, _, err := call(ctx, c, ResourceCore, func() (*github.Issue, *github.Response, error) {
+		return c.client.Issues.Get(ctx, owner, repo, issueNumber)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get issue: %w", err)
+	}
+	return issue, nil
+}
+
+// GetIssueComments fetches the comments of an issue, following pagination up to the configured cap.
+// Comments are served from the cache when the issue has not been updated since they were cached
+// with the same cap.
+func (c *Client) GetIssueComments(ctx context.Context, owner, repo string, issue *github.Issue) ([]*github.IssueComment, error) {
 	if issue == nil || issue.Number == nil {
 		return nil, fmt.Errorf("issue is nil or does not have a number")
 	}
 
-	comments, _, err := c.client.Issues.ListComments(c.ctx, owner, repo, *issue.Number, nil)
+	if c.cache != nil && issue.UpdatedAt != nil {
+		if entry, ok := c.cache.GetIssue(c.client.BaseURL.Host, owner, repo, *issue.Number, issue.UpdatedAt.Time, c.maxComments); ok {
+			return entry.Comments, nil
+		}
+	}
+
+	comments, err := c.listComments(ctx, owner, repo, *issue.Number, c.maxComments)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list comments for issue #%d: %w", *issue.Number, err)
+		return nil, err
+	}
+
+	if c.cache != nil && issue.UpdatedAt != nil {
+		entry := &cache.IssueEntry{UpdatedAt: issue.UpdatedAt.Time, MaxComments: c.maxComments, Issue: issue, Comments: comments}
+		if err := c.cache.PutIssue(c.client.BaseURL.Host, owner, repo, *issue.Number, entry); err != nil {
+			log.Printf("Failed to cache issue #%d: %v", *issue.Number, err)
+		}
 	}
 
 	return comments, nil
 }
 
-// SearchIssues searches for issues in the repository.
-func (c *Client) SearchIssues(owner, repo, query string) ([]*github.Issue, error) {
+// listComments fetches the comments of an issue page by page, stopping after `limit` comments (0 means no limit)
+func (c *Client) listComments(ctx context.Context, owner, repo string, issueNumber, limit int) ([]*github.IssueComment, error) {
+	var allComments []*github.IssueComment
+
+	opts := &github.IssueListCommentsOptions{
+		ListOptions: github.ListOptions{PerPage: maxPerPage},
+	}
+	for {
+		comments, resp, err := call(ctx, c, ResourceCore, func() ([]*github.IssueComment, *github.Response, error) {
+			return c.client.Issues.ListComments(ctx, owner, repo, issueNumber, opts)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list comments for issue #%d: %w", issueNumber, err)
+		}
+		allComments = append(allComments, comments...)
+
+		if limit > 0 && len(allComments) >= limit {
+			if resp.NextPage != 0 || len(allComments) > limit {
+				log.Printf("Issue #%d has more than %d comments, ignoring the remaining ones", issueNumber, limit)
+			}
+			allComments = allComments[:limit]
+			break
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return allComments, nil
+}
+
+// SearchIssues searches for closed issues in the repository, following pagination up to the configured cap.
+func (c *Client) SearchIssues(ctx context.Context, owner, repo, query string) ([]*github.Issue, error) {
 	fullQuery := fmt.Sprintf("%s repo:%s/%s is:issue is:closed", query, owner, repo)
+	return c.search(ctx, fullQuery, c.maxSearchResults)
+}
+
+// FindIssues returns up to `limit` issues of the repository matching a GitHub search query
+// (e.g. "label:SDH is:open no:assignee"), whatever their state.
+func (c *Client) FindIssues(ctx context.Context, owner, repo, query string, limit int) ([]*github.Issue, error) {
+	fullQuery := fmt.Sprintf("%s repo:%s/%s is:issue", query, owner, repo)
+	return c.search(ctx, fullQuery, limit)
+}
+
+// search runs a GitHub issue search, following pagination until `limit` issues are found
+func (c *Client) search(ctx context.Context, fullQuery string, limit int) ([]*github.Issue, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
 	opts := &github.SearchOptions{
 		ListOptions: github.ListOptions{
 			// Use GitHub's default "best-match" search algorithm
-			PerPage: 20, // Limit to top 50 relevant issues
+			PerPage: min(limit, maxPerPage),
 		},
 	}
 
-	result, _, err := c.client.Search.Issues(c.ctx, fullQuery, opts)
-	if err != nil {
-		return nil, fmt.Errorf("failed to search issues: %w", err)
+	var issues []*github.Issue
+	for {
+		result, resp, err := call(ctx, c, ResourceSearch, func() (*github.IssuesSearchResult, *github.Response, error) {
+			return c.client.Search.Issues(ctx, fullQuery, opts)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to search issues: %w", err)
+		}
+		issues = append(issues, result.Issues...)
+
+		if len(issues) >= limit {
+			issues = issues[:limit]
+			break
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
 	}
-	return result.Issues, nil
+
+	return issues, nil
+}
+
+// ListClosedIssues lists all closed issues of the repository, excluding pull requests.
+func (c *Client) ListClosedIssues(ctx context.Context, owner, repo string) ([]*github.Issue, error) {
+	opts := &github.IssueListByRepoOptions{
+		State:       "closed",
+		ListOptions: github.ListOptions{PerPage: maxPerPage},
+	}
+
+	var issues []*github.Issue
+	for {
+		page, resp, err := call(ctx, c, ResourceCore, func() ([]*github.Issue, *github.Response, error) {
+			return c.client.Issues.ListByRepo(ctx, owner, repo, opts)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list closed issues: %w", err)
+		}
+
+		for _, issue := range page {
+			if !issue.IsPullRequest() {
+				issues = append(issues, issue)
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return issues, nil
 }
 
 // PostComment posts a comment to a GitHub issue.
-func (c *Client) PostComment(owner, repo string, issueNumber int, body string) error {
+func (c *Client) PostComment(ctx context.Context, owner, repo string, issueNumber int, body string) error {
 	comment := &github.IssueComment{Body: &body}
-	_, _, err := c.client.Issues.CreateComment(c.ctx, owner, repo, issueNumber, comment)
+	_, _, err := call(ctx, c, ResourceCore, func() (*github.IssueComment, *github.Response, error) {
+		return c.client.Issues.CreateComment(ctx, owner, repo, issueNumber, comment)
+	})
 	if err != nil {
 		return fmt.Errorf("failed to post comment: %w", err)
 	}
 	return nil
 }
+
+// FindComment returns the most recent comment on a GitHub issue written by the authenticated user
+// whose body contains `marker`, or nil if no such comment exists. Comments of other users are ignored
+// even if they contain the marker (e.g. when quoting a report), so that they are never edited.
+func (c *Client) FindComment(ctx context.Context, owner, repo string, issueNumber int, marker string) (*github.IssueComment, error) {
+	login, err := c.AuthenticatedLogin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	comments, err := c.listComments(ctx, owner, repo, issueNumber, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *github.IssueComment
+	for _, comment := range comments {
+		if strings.EqualFold(comment.GetUser().GetLogin(), login) && strings.Contains(comment.GetBody(), marker) {
+			found = comment
+		}
+	}
+
+	return found, nil
+}
+
+// AuthenticatedLogin returns the login of the user the client authenticates as,
+// or of the bot user of the GitHub App when authenticating as an app installation
+func (c *Client) AuthenticatedLogin(ctx context.Context) (string, error) {
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+
+	if c.login != "" {
+		return c.login, nil
+	}
+
+	// Installation tokens cannot read the authenticated user, the app itself is read with its JWT
+	if c.app != nil {
+		login, err := c.app.botLogin(ctx)
+		if err != nil {
+			return "", err
+		}
+		c.login = login
+		return login, nil
+	}
+
+	user, _, err := call(ctx, c, ResourceCore, func() (*github.User, *github.Response, error) {
+		return c.client.Users.Get(ctx, "")
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get authenticated user: %w", err)
+	}
+	c.login = user.GetLogin()
+	return c.login, nil
+}
+
+// EditComment replaces the body of an existing GitHub issue comment.
+func (c *Client) EditComment(ctx context.Context, owner, repo string, commentID int64, body string) error {
+	comment := &github.IssueComment{Body: &body}
+	_, _, err := call(ctx, c, ResourceCore, func() (*github.IssueComment, *github.Response, error) {
+		return c.client.Issues.EditComment(ctx, owner, repo, commentID, comment)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to edit comment %d: %w", commentID, err)
+	}
+	return nil
+}
+
+// AddCommentReaction adds a reaction (e.g. "eyes" or "+1") to an issue comment.
+func (c *Client) AddCommentReaction(ctx context.Context, owner, repo string, commentID int64, reaction string) error {
+	_, _, err := call(ctx, c, ResourceCore, func() (*github.Reaction, *github.Response, error) {
+		return c.client.Reactions.CreateIssueCommentReaction(ctx, owner, repo, commentID, reaction)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add reaction to comment %d: %w", commentID, err)
+	}
+	return nil
+}
+
+// IsOrgMember reports whether a user is a member of an organization.
+func (c *Client) IsOrgMember(ctx context.Context, org, user string) (bool, error) {
+	member, _, err := call(ctx, c, ResourceCore, func() (bool, *github.Response, error) {
+		return c.client.Organizations.IsMember(ctx, org, user)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check membership of %s in %s: %w", user, org, err)
+	}
+	return member, nil
+}
+
+// IsTeamMember reports whether a user is an active member of an organization team.
+func (c *Client) IsTeamMember(ctx context.Context, org, teamSlug, user string) (bool, error) {
+	membership, resp, err := call(ctx, c, ResourceCore, func() (*github.Membership, *github.Response, error) {
+		return c.client.Teams.GetTeamMembershipBySlug(ctx, org, teamSlug, user)
+	})
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check membership of %s in %s/%s: %w", user, org, teamSlug, err)
+	}
+	return membership.GetState() == "active", nil
+}
+
+// CheckRepoAccess verifies that the repository exists and is readable with the client's credentials.
+func (c *Client) CheckRepoAccess(ctx context.Context, owner, repo string) error {
+	_, _, err := call(ctx, c, ResourceCore, func() (*github.Repository, *github.Response, error) {
+		return c.client.Repositories.Get(ctx, owner, repo)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to access repository %s/%s: %w", owner, repo, err)
+	}
+	return nil
+}
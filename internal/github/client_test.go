@@ -0,0 +1,94 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestEnterpriseBaseURL checks that a client configured with a base URL talks to the
+// GitHub Enterprise Server REST API under /api/v3/ instead of api.github.com
+func TestEnterpriseBaseURL(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/acme/sdh/issues/42", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer test-token" {
+			t.Errorf("Authorization header = %q, want %q", got, "Bearer test-token")
+		}
+		json.NewEncoder(w).Encode(map[string]any{"number": 42, "title": "Replication lag"})
+	})
+	mux.HandleFunc("GET /api/v3/repos/acme/sdh/issues/42/comments", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]map[string]any{{"id": 1, "body": "Seen on 7.4"}})
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		http.NotFound(w, r)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := NewClient("test-token", Options{BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	content, err := client.GetIssueContent(context.Background(), "acme", "sdh", 42)
+	if err != nil {
+		t.Fatalf("GetIssueContent() error = %v", err)
+	}
+
+	if got := content.Issue.GetTitle(); got != "Replication lag" {
+		t.Errorf("issue title = %q, want %q", got, "Replication lag")
+	}
+	if len(content.Comments) != 1 || content.Comments[0].GetBody() != "Seen on 7.4" {
+		t.Errorf("comments = %v, want a single comment", content.Comments)
+	}
+}
+
+// TestEnterpriseUploadURL checks that the upload URL defaults to the base URL
+func TestEnterpriseUploadURL(t *testing.T) {
+	client, err := NewClient("test-token", Options{BaseURL: "https://github.example.com"})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if got, want := client.client.BaseURL.String(), "https://github.example.com/api/v3/"; got != want {
+		t.Errorf("BaseURL = %q, want %q", got, want)
+	}
+	if got, want := client.client.UploadURL.String(), "https://github.example.com/api/uploads/"; got != want {
+		t.Errorf("UploadURL = %q, want %q", got, want)
+	}
+}
+
+// TestFindCommentIgnoresOtherAuthors checks that only comments of the authenticated user are matched,
+// so that a user quoting the marker never gets their comment edited
+func TestFindCommentIgnoresOtherAuthors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/user", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"login": "sdh-bot"})
+	})
+	mux.HandleFunc("GET /api/v3/repos/acme/sdh/issues/42/comments", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]map[string]any{
+			{"id": 1, "body": "<!-- marker --> report", "user": map[string]any{"login": "SDH-Bot"}},
+			{"id": 2, "body": "> <!-- marker --> quoted", "user": map[string]any{"login": "alice"}},
+		})
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := NewClient("test-token", Options{BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	comment, err := client.FindComment(context.Background(), "acme", "sdh", 42, "<!-- marker -->")
+	if err != nil {
+		t.Fatalf("FindComment() error = %v", err)
+	}
+	if comment == nil || comment.GetID() != 1 {
+		t.Errorf("FindComment() = %v, want comment 1", comment)
+	}
+}
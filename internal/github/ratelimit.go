@@ -0,0 +1,144 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"sdh-agent/pkg/utils"
+
+	"github.com/google/go-github/v63/github"
+)
+
+// GitHub rate limit resources used by the client, each with its own quota
+const (
+	ResourceCore   = "core"
+	ResourceSearch = "search"
+)
+
+const (
+	// maxRateLimitRetries caps the retries of a call rejected by a rate limit
+	maxRateLimitRetries = 3
+	// maxRateLimitWait is the longest the client waits for a rate limit to reset, longer waits
+	// are left to the caller (e.g. the job queue reschedules the job)
+	maxRateLimitWait = 15 * time.Minute
+	// defaultAbuseRetryAfter is the backoff after hitting a secondary rate limit without a Retry-After header
+	defaultAbuseRetryAfter = time.Minute
+)
+
+// lowRemaining is the number of remaining requests below which calls wait for the quota to reset,
+// leaving headroom for requests already in flight
+var lowRemaining = map[string]int{
+	ResourceCore:   10,
+	ResourceSearch: 1,
+}
+
+// RateBudget is the last known state of the rate limit quota of a resource
+type RateBudget struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// rateTracker records the rate limit budgets reported by the X-RateLimit-* response headers
+type rateTracker struct {
+	mu      sync.Mutex
+	budgets map[string]RateBudget
+}
+
+// update records the rate limit state of a response
+func (t *rateTracker) update(resource string, rate github.Rate) {
+	// Responses without rate limit headers (e.g. from a proxy) carry no information
+	if rate.Limit == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.budgets == nil {
+		t.budgets = make(map[string]RateBudget)
+	}
+	t.budgets[resource] = RateBudget{Limit: rate.Limit, Remaining: rate.Remaining, Reset: rate.Reset.Time}
+}
+
+// get returns the last known budget of a resource
+func (t *rateTracker) get(resource string) (RateBudget, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	budget, ok := t.budgets[resource]
+	return budget, ok
+}
+
+// wait blocks until the quota of a resource resets if it is nearly exhausted
+func (t *rateTracker) wait(ctx context.Context, resource string) error {
+	budget, ok := t.get(resource)
+	if !ok || budget.Remaining > lowRemaining[resource] {
+		return nil
+	}
+
+	delay := time.Until(budget.Reset)
+	if delay <= 0 || delay > maxRateLimitWait {
+		return nil
+	}
+
+	log.Printf("GitHub %s rate limit nearly exhausted (%d of %d remaining), waiting %s for the reset",
+		resource, budget.Remaining, budget.Limit, delay.Round(time.Second))
+	return utils.Sleep(ctx, delay)
+}
+
+// RateBudget returns the last known rate limit budget of a resource (ResourceCore or ResourceSearch),
+// or false if no request to that resource has been made yet
+func (c *Client) RateBudget(resource string) (RateBudget, bool) {
+	return c.rates.get(resource)
+}
+
+// call runs a GitHub API request against a rate-limited resource. It waits for the quota to reset
+// when it is nearly exhausted, and retries requests rejected by primary or secondary rate limits.
+func call[T any](ctx context.Context, c *Client, resource string, request func() (T, *github.Response, error)) (T, *github.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := c.rates.wait(ctx, resource); err != nil {
+			var zero T
+			return zero, nil, err
+		}
+
+		result, resp, err := request()
+		if resp != nil {
+			c.rates.update(resource, resp.Rate)
+		}
+
+		delay, limited := c.rateLimitDelay(resource, err)
+		if !limited || attempt >= maxRateLimitRetries || delay > maxRateLimitWait {
+			return result, resp, err
+		}
+
+		log.Printf("GitHub %s rate limit exceeded, retrying in %s", resource, delay.Round(time.Second))
+		if err := utils.Sleep(ctx, delay); err != nil {
+			var zero T
+			return zero, resp, err
+		}
+	}
+}
+
+// rateLimitDelay returns how long to wait before retrying a request that failed with `err`,
+// and false if the error is not caused by a rate limit
+func (c *Client) rateLimitDelay(resource string, err error) (time.Duration, bool) {
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		c.rates.update(resource, rateErr.Rate)
+		return max(time.Until(rateErr.Rate.Reset.Time), time.Second), true
+	}
+
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		if retryAfter := abuseErr.GetRetryAfter(); retryAfter > 0 {
+			return retryAfter, true
+		}
+		return defaultAbuseRetryAfter, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,91 @@
+package github
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// IssueReference identifies an issue by an optional host and repository and its number
+type IssueReference struct {
+	// Host is the GitHub host of an issue URL, empty for other forms
+	Host string
+	// Owner and Repo are empty when the reference does not name a repository
+	Owner  string
+	Repo   string
+	Number int
+}
+
+// HasRepo reports whether the reference names a repository
+func (r IssueReference) HasRepo() bool {
+	return r.Owner != "" && r.Repo != ""
+}
+
+// String formats the reference as "owner/repo#number" or "#number"
+func (r IssueReference) String() string {
+	if !r.HasRepo() {
+		return fmt.Sprintf("#%d", r.Number)
+	}
+	return fmt.Sprintf("%s/%s#%d", r.Owner, r.Repo, r.Number)
+}
+
+// ParseIssueReference parses an issue given as a URL (https://<host>/owner/repo/issues/123),
+// as "owner/repo#123", as "#123" or as a bare number
+func ParseIssueReference(s string) (IssueReference, error) {
+	s = strings.TrimSpace(s)
+
+	if strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") {
+		return parseIssueURL(s)
+	}
+
+	var ref IssueReference
+	repo, number, found := strings.Cut(s, "#")
+	if !found {
+		number = s
+	} else if repo != "" {
+		owner, name, ok := strings.Cut(repo, "/")
+		if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+			return IssueReference{}, fmt.Errorf("invalid issue reference %q, expected owner/repo#number", s)
+		}
+		ref.Owner, ref.Repo = owner, name
+	}
+
+	n, err := parseIssueNumber(number)
+	if err != nil {
+		return IssueReference{}, fmt.Errorf("invalid issue reference %q: %w", s, err)
+	}
+	ref.Number = n
+
+	return ref, nil
+}
+
+// parseIssueURL parses the URL of an issue on github.com or a GitHub Enterprise host
+func parseIssueURL(s string) (IssueReference, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return IssueReference{}, fmt.Errorf("invalid issue URL %q: %w", s, err)
+	}
+
+	// Expect /owner/repo/issues/123, ignoring a trailing slash
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if u.Host == "" || len(parts) != 4 || parts[0] == "" || parts[1] == "" || parts[2] != "issues" {
+		return IssueReference{}, fmt.Errorf("invalid issue URL %q, expected https://<host>/owner/repo/issues/number", s)
+	}
+
+	n, err := parseIssueNumber(parts[3])
+	if err != nil {
+		return IssueReference{}, fmt.Errorf("invalid issue URL %q: %w", s, err)
+	}
+
+	return IssueReference{Host: u.Host, Owner: parts[0], Repo: parts[1], Number: n}, nil
+}
+
+// parseIssueNumber parses a positive issue number
+func parseIssueNumber(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid issue number %q", s)
+	}
+	return n, nil
+}
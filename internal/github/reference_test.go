@@ -0,0 +1,74 @@
+package github
+
+import "testing"
+
+// TestParseIssueReference checks the parsing of issue numbers, cross-repository references and issue URLs
+func TestParseIssueReference(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    IssueReference
+		wantErr bool
+	}{
+		{name: "bare number", input: "123", want: IssueReference{Number: 123}},
+		{name: "surrounding whitespace", input: " 123\n", want: IssueReference{Number: 123}},
+		{name: "hash number", input: "#123", want: IssueReference{Number: 123}},
+		{name: "cross-repository reference", input: "org/repo#123", want: IssueReference{Owner: "org", Repo: "repo", Number: 123}},
+		{
+			name:  "github.com URL",
+			input: "https://github.com/org/repo/issues/123",
+			want:  IssueReference{Host: "github.com", Owner: "org", Repo: "repo", Number: 123},
+		},
+		{
+			name:  "GitHub Enterprise Server URL",
+			input: "https://github.example.com/org/repo/issues/123",
+			want:  IssueReference{Host: "github.example.com", Owner: "org", Repo: "repo", Number: 123},
+		},
+		{
+			name:  "http URL with port",
+			input: "http://ghes.internal:8080/org/repo/issues/7",
+			want:  IssueReference{Host: "ghes.internal:8080", Owner: "org", Repo: "repo", Number: 7},
+		},
+		{
+			name:  "trailing slash",
+			input: "https://github.com/org/repo/issues/123/",
+			want:  IssueReference{Host: "github.com", Owner: "org", Repo: "repo", Number: 123},
+		},
+		{
+			name:  "comment fragment",
+			input: "https://github.com/org/repo/issues/123#issuecomment-456",
+			want:  IssueReference{Host: "github.com", Owner: "org", Repo: "repo", Number: 123},
+		},
+		{
+			name:  "query string",
+			input: "https://github.com/org/repo/issues/123?notification_referrer_id=1",
+			want:  IssueReference{Host: "github.com", Owner: "org", Repo: "repo", Number: 123},
+		},
+		{name: "pull request URL", input: "https://github.com/org/repo/pull/123", wantErr: true},
+		{name: "issue sub-page URL", input: "https://github.com/org/repo/issues/123/linked_closing_reference", wantErr: true},
+		{name: "repository URL", input: "https://github.com/org/repo", wantErr: true},
+		{name: "URL without number", input: "https://github.com/org/repo/issues/", wantErr: true},
+		{name: "URL without host", input: "https:///org/repo/issues/123", wantErr: true},
+		{name: "empty", input: "", wantErr: true},
+		{name: "hash only", input: "#", wantErr: true},
+		{name: "zero", input: "0", wantErr: true},
+		{name: "negative number", input: "-5", wantErr: true},
+		{name: "word", input: "analyze", wantErr: true},
+		{name: "reference without repository", input: "org#123", wantErr: true},
+		{name: "reference with empty owner", input: "/repo#123", wantErr: true},
+		{name: "reference with nested path", input: "org/repo/extra#123", wantErr: true},
+		{name: "reference with invalid number", input: "org/repo#abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseIssueReference(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseIssueReference(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseIssueReference(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
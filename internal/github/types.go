@@ -2,26 +2,95 @@ package github
 
 import (
 	"context"
+	"fmt"
+	"sync"
+
+	"sdh-agent/internal/cache"
 
 	"github.com/google/go-github/v63/github"
 	"golang.org/x/oauth2"
 )
 
+const (
+	// Default caps applied when the corresponding option is not set
+	defaultMaxComments      = 1000
+	defaultMaxSearchResults = 20
+)
+
 // Client is a wrapper around the go-github client
 type Client struct {
 	client *github.Client
-	ctx    context.Context
+	// Caps on paginated requests
+	maxComments      int
+	maxSearchResults int
+	// cache stores issues and comments between runs, nil if caching is disabled
+	cache *cache.Cache
+	// rates tracks the remaining rate limit quota of each resource
+	rates rateTracker
+	// app mints the tokens of GitHub App authentication, nil when authenticating with a token
+	app *appTokenSource
+
+	// login is the authenticated user or bot, resolved on first use
+	loginMu sync.Mutex
+	login   string
 }
 
-// NewClient creates a new GitHub API client
-func NewClient(token string) *Client {
-	ctx := context.Background()
+// Options holds optional settings for the GitHub client
+type Options struct {
+	// MaxComments caps the number of comments fetched per issue
+	MaxComments int
+	// MaxSearchResults caps the number of issues returned per search query
+	MaxSearchResults int
+	// Cache is used to avoid re-fetching unchanged issues, may be nil
+	Cache *cache.Cache
+	// BaseURL and UploadURL point the client to a GitHub Enterprise Server instance,
+	// github.com is used if BaseURL is empty. UploadURL defaults to BaseURL.
+	BaseURL   string
+	UploadURL string
+	// App authenticates as a GitHub App installation instead of with the token, may be nil
+	App *AppCredentials
+}
+
+// NewClient creates a new GitHub API client, authenticating with the token or, if set, the GitHub App of the options
+func NewClient(token string, opts Options) (*Client, error) {
+	if opts.MaxComments <= 0 {
+		opts.MaxComments = defaultMaxComments
+	}
+	if opts.MaxSearchResults <= 0 {
+		opts.MaxSearchResults = defaultMaxSearchResults
+	}
+
+	uploadURL := opts.UploadURL
+	if uploadURL == "" {
+		uploadURL = opts.BaseURL
+	}
+
 	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
-	tc := oauth2.NewClient(ctx, ts)
-	return &Client{
-		client: github.NewClient(tc),
-		ctx:    ctx,
+	var app *appTokenSource
+	if opts.App != nil {
+		var err error
+		if app, err = newAppTokenSource(*opts.App, opts.BaseURL, uploadURL); err != nil {
+			return nil, err
+		}
+		ts = app.reusable()
 	}
+	tc := oauth2.NewClient(context.Background(), ts)
+
+	client := github.NewClient(tc)
+	if opts.BaseURL != "" {
+		var err error
+		if client, err = client.WithEnterpriseURLs(opts.BaseURL, uploadURL); err != nil {
+			return nil, fmt.Errorf("failed to configure GitHub Enterprise URLs: %w", err)
+		}
+	}
+
+	return &Client{
+		client:           client,
+		maxComments:      opts.MaxComments,
+		maxSearchResults: opts.MaxSearchResults,
+		cache:            opts.Cache,
+		app:              app,
+	}, nil
 }
 
 // GitHubIssueContent represents a GitHub issue along with its comments
@@ -0,0 +1,165 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Document is an indexed issue along with its embedding vector
+type Document struct {
+	// Host is the GitHub instance of the issue, e.g. github.com or a GitHub Enterprise Server host
+	Host        string    `json:"host"`
+	Owner       string    `json:"owner"`
+	Repo        string    `json:"repo"`
+	IssueNumber int       `json:"issue_number"`
+	Title       string    `json:"title"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Vector      []float32 `json:"vector"`
+}
+
+// Match is a document returned by a nearest-neighbour search
+type Match struct {
+	Document *Document
+	// Similarity is the cosine similarity between the document and the query vector
+	Similarity float64
+}
+
+// Index is a local vector index of issues persisted as a JSON file
+type Index struct {
+	path      string
+	documents map[string]*Document
+}
+
+// Load reads the index stored at `path`, returning an empty index if the file does not exist yet
+func Load(path string) (*Index, error) {
+	index := &Index{
+		path:      path,
+		documents: make(map[string]*Document),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index %s: %w", path, err)
+	}
+
+	var documents []*Document
+	if err := json.Unmarshal(data, &documents); err != nil {
+		return nil, fmt.Errorf("failed to decode index %s: %w", path, err)
+	}
+	for _, doc := range documents {
+		// Documents indexed without their host cannot be attributed to a GitHub instance, they are indexed again
+		if doc.Host == "" {
+			continue
+		}
+		index.documents[doc.key()] = doc
+	}
+
+	return index, nil
+}
+
+// Save writes the index to disk, replacing the previous file atomically
+func (i *Index) Save() error {
+	documents := make([]*Document, 0, len(i.documents))
+	for _, doc := range i.documents {
+		documents = append(documents, doc)
+	}
+	sort.Slice(documents, func(a, b int) bool {
+		return documents[a].key() < documents[b].key()
+	})
+
+	data, err := json.Marshal(documents)
+	if err != nil {
+		return fmt.Errorf("failed to encode index: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(i.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create index directory: %w", err)
+	}
+
+	tmpPath := i.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	if err := os.Rename(tmpPath, i.path); err != nil {
+		return fmt.Errorf("failed to replace index: %w", err)
+	}
+
+	return nil
+}
+
+// Len returns the number of documents in the index
+func (i *Index) Len() int {
+	return len(i.documents)
+}
+
+// Get returns the indexed document of an issue of the GitHub instance at `host`, or nil if the issue is not indexed
+func (i *Index) Get(host, owner, repo string, issueNumber int) *Document {
+	return i.documents[documentKey(host, owner, repo, issueNumber)]
+}
+
+// Put adds a document to the index, replacing any previous document for the same issue
+func (i *Index) Put(doc *Document) {
+	i.documents[doc.key()] = doc
+}
+
+// Nearest returns the `k` documents of a repository of the GitHub instance at `host` most similar to `vector`,
+// most similar first
+func (i *Index) Nearest(host, owner, repo string, vector []float32, k int) []Match {
+	var matches []Match
+	for _, doc := range i.documents {
+		if doc.Host != host || doc.Owner != owner || doc.Repo != repo || len(doc.Vector) != len(vector) {
+			continue
+		}
+		matches = append(matches, Match{Document: doc, Similarity: cosineSimilarity(doc.Vector, vector)})
+	}
+
+	// Sort by similarity, then by issue number for a deterministic order
+	sort.Slice(matches, func(a, b int) bool {
+		if matches[a].Similarity != matches[b].Similarity {
+			return matches[a].Similarity > matches[b].Similarity
+		}
+		return matches[a].Document.IssueNumber < matches[b].Document.IssueNumber
+	})
+
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+
+	return matches
+}
+
+// cosineSimilarity computes the cosine similarity of two vectors of the same length
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// key returns the key of the document in the index
+func (doc *Document) key() string {
+	return documentKey(doc.Host, doc.Owner, doc.Repo, doc.IssueNumber)
+}
+
+// documentKey builds the key of an issue in the index, including the GitHub host so that the issues
+// of different GitHub instances (e.g. github.com and GitHub Enterprise Server) are kept apart
+func documentKey(host, owner, repo string, issueNumber int) string {
+	return fmt.Sprintf("%s/%s/%s#%d", host, owner, repo, issueNumber)
+}
@@ -3,13 +3,11 @@ package anthropic
 import (
 	"context"
 	"fmt"
-	"math"
-	"math/rand"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
-	"sdh-agent/internal/prompts"
 	"sdh-agent/pkg/utils"
 
 	"golang.org/x/time/rate"
@@ -19,167 +17,317 @@ const (
 	apiURL = "https://api.anthropic.com/v1/messages"
 	// Using the latest model available at the time of writing.
 	// This might need updating in the future.
-	model = "claude-3-5-haiku-latest"
+	defaultModel     = "claude-3-5-haiku-latest"
+	defaultMaxTokens = 4096 // Max output tokens
+
+	// defaultBaseBackoff is the first retry delay when the API does not send a retry-after header
+	defaultBaseBackoff = 15 * time.Second
+	// streamTimeout bounds streamed requests, which last as long as the generation
+	streamTimeout = 10 * time.Minute
 
 	// Rate limiting configurations
-	tokensPerMinute  = 19000 // Anthropic's limit is 20000 tokens per minute, we use a conservative estimate
-	avgCharsPerToken = 4.0   // Average characters per token for English text
-	baseTokens       = 3     // Base tokens per message (conservative estimate)
+	tokensPerMinute = 19000 // Anthropic's limit is 20000 tokens per minute, we use a conservative estimate
 )
 
+// retryableStatusCodes are the rate limit, server and overload (529) errors that are retried
+var retryableStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+	529,
+}
+
+// Anthropic rate limits apply per API key, so all clients created with
+// the same key share a single rate limiter
+var (
+	rateLimitersMu sync.Mutex
+	rateLimiters   = map[string]*rate.Limiter{}
+)
+
+// Settings holds the generation settings of a client
+type Settings struct {
+	// Model defaults to `defaultModel` when empty
+	Model string
+	// MaxTokens defaults to `defaultMaxTokens` when 0
+	MaxTokens int
+	// Temperature uses the API default when nil
+	Temperature *float64
+	// BaseBackoff is the first retry delay, doubled on each retry, defaults to `defaultBaseBackoff` when 0
+	BaseBackoff time.Duration
+}
+
 // Client is a wrapper for the Anthropic API
 type Client struct {
-	apiKey      string
-	httpClient  *http.Client
-	rateLimiter *rate.Limiter
+	apiKey string
+	// endpoint is the Messages API URL, `apiURL` unless replaced in tests
+	endpoint   string
+	settings   Settings
+	httpClient *http.Client
+	// streamClient sends streamed requests, without the shorter timeout of `httpClient`
+	streamClient *http.Client
+	rateLimiter  *rate.Limiter
 	// Add backoff configuration
 	maxRetries  int
 	baseBackoff time.Duration
 }
 
 // NewClient creates a new Anthropic API client.
-func NewClient(apiKey string) *Client {
-	// Create a rate limiter with `tokensPerMinute` tokens per minute (slightly under the limit)
-	// and burst of `tokensPerMinute` tokens maximum
-	limiter := rate.NewLimiter(rate.Limit(tokensPerMinute/60), tokensPerMinute)
+func NewClient(apiKey string, settings Settings) *Client {
+	if settings.Model == "" {
+		settings.Model = defaultModel
+	}
+	if settings.MaxTokens <= 0 {
+		settings.MaxTokens = defaultMaxTokens
+	}
+	if settings.BaseBackoff <= 0 {
+		settings.BaseBackoff = defaultBaseBackoff
+	}
 
 	return &Client{
-		apiKey:      apiKey,
-		httpClient:  utils.CreateDefaultHTTPClient(),
-		rateLimiter: limiter,
-		maxRetries:  5,
-		baseBackoff: 15 * time.Second, // Base backoff of 15 seconds
+		apiKey:       apiKey,
+		endpoint:     apiURL,
+		settings:     settings,
+		httpClient:   utils.CreateDefaultHTTPClient(),
+		streamClient: utils.CreateHTTPClient(streamTimeout),
+		rateLimiter:  rateLimiterFor(apiKey),
+		maxRetries:   5,
+		baseBackoff:  settings.BaseBackoff,
+	}
+}
+
+// rateLimiterFor returns the rate limiter shared by all clients using `apiKey`
+func rateLimiterFor(apiKey string) *rate.Limiter {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+
+	limiter, ok := rateLimiters[apiKey]
+	if !ok {
+		// Create a rate limiter with `tokensPerMinute` tokens per minute (slightly under the limit)
+		// and burst of `tokensPerMinute` tokens maximum
+		limiter = rate.NewLimiter(rate.Limit(tokensPerMinute/60), tokensPerMinute)
+		rateLimiters[apiKey] = limiter
 	}
+
+	return limiter
+}
+
+// Generate sends a request to the Anthropic API and returns the generated text with its token usage
+func (c *Client) Generate(ctx context.Context, req Request) (*Result, error) {
+	return c.send(ctx, req, c.makeRequest)
 }
 
-// GenerateText sends a request to the Anthropic API and returns the generated text
-func (c *Client) GenerateText(messages []string) (string, error) {
-	// Wait for rate limiter (estimate 1 token per character as a conservative approach)
-	ctx := context.Background()
-	estimatedTokens := estimateTokenCount(messages)
+// Stream sends a request to the Anthropic API with streaming enabled, calling `onText` with each piece
+// of text as it is generated, and returns the full generated text with its token usage.
+// Requests are only retried when they fail before any text was generated.
+func (c *Client) Stream(ctx context.Context, req Request, onText func(text string)) (*Result, error) {
+	return c.send(ctx, req, func(ctx context.Context, req Request) (*Result, error) {
+		return c.makeStreamingRequest(ctx, req, onText)
+	})
+}
+
+// send makes a request with `makeRequest`, rate limited and retried on rate limit, server and overload errors
+func (c *Client) send(ctx context.Context, req Request, makeRequest func(context.Context, Request) (*Result, error)) (*Result, error) {
+	// Wait for rate limiter with an estimate of the input tokens, including the system prompt.
+	// The actual usage is charged once the response is received.
+	texts := []string{req.System}
+	for _, message := range req.Messages {
+		texts = append(texts, message.Content)
+	}
+	estimatedTokens := min(utils.EstimateTokenCount(texts), c.rateLimiter.Burst())
 	if err := c.rateLimiter.WaitN(ctx, estimatedTokens); err != nil {
-		return "", fmt.Errorf("rate limiter wait error: %w", err)
+		return nil, fmt.Errorf("rate limiter wait error: %w", err)
 	}
 
 	// Attempt request with retries and exponential backoff
 	var lastErr error
 	for attempt := 0; attempt < c.maxRetries; attempt++ {
-		response, err := c.makeRequest(messages)
+		result, err := makeRequest(ctx, req)
 		if err == nil {
 			// Success!
-			return response, nil
+			c.chargeUsage(estimatedTokens, result.Usage)
+			return result, nil
 		}
 
-		// Check if error is a rate limit error
-		if isRateLimitError(err) {
-			lastErr = err
-
-			// Calculate backoff duration with jitter
-			backoffDuration := c.calculateBackoff(attempt)
-			time.Sleep(backoffDuration)
-			continue
+		// Not a rate limit, server or overload error, return immediately
+		if !utils.IsRetryableStatus(err, retryableStatusCodes...) {
+			return nil, err
 		}
+		lastErr = err
 
-		// Not a rate limit error, return immediately
-		return "", err
+		// Wait as long as the API asks to, or back off exponentially with jitter
+		delay, ok := utils.RetryDelay(err, c.baseBackoff, attempt)
+		if !ok {
+			return nil, fmt.Errorf("API asked to retry in %s, giving up: %w", delay.Round(time.Second), err)
+		}
+		if err := utils.Sleep(ctx, delay); err != nil {
+			return nil, err
+		}
 	}
 
 	// All retries failed
-	return "", fmt.Errorf("max retries exceeded: %w", lastErr)
+	return nil, fmt.Errorf("max retries exceeded: %w", lastErr)
 }
 
-// isRateLimitError checks if an error is a rate limit error
-func isRateLimitError(err error) bool {
-	// Check if error message contains rate limit indicators
-	errMsg := err.Error()
-	return err != nil && (strings.Contains(errMsg, "429") ||
-		strings.Contains(errMsg, "rate_limit_error") ||
-		strings.Contains(errMsg, "exceed the rate limit"))
+// chargeUsage takes the tokens a request actually used beyond the estimate it waited for from the
+// rate limiter, so that the following requests are delayed accordingly. Tokens read from the
+// prompt cache do not count towards the rate limits.
+func (c *Client) chargeUsage(estimatedTokens int, usage Usage) {
+	extra := usage.InputTokens + usage.CacheCreationInputTokens + usage.OutputTokens - estimatedTokens
+	if extra <= 0 {
+		return
+	}
+	c.rateLimiter.ReserveN(time.Now(), min(extra, c.rateLimiter.Burst()))
 }
 
-// calculateBackoff calculates the backoff duration with jitter
-func (c *Client) calculateBackoff(attempt int) time.Duration {
-	// Exponential backoff: baseBackoff * 2^attempt + random jitter
-	backoff := float64(c.baseBackoff) * math.Pow(2, float64(attempt))
+// newAPIRequest builds the API request body of a request
+func (c *Client) newAPIRequest(req Request) anthropicRequest {
+	reqBody := anthropicRequest{
+		Model:         c.settings.Model,
+		Messages:      convertToMessages(req.Messages, req.CachePrefix),
+		MaxTokens:     c.settings.MaxTokens,
+		Temperature:   c.settings.Temperature,
+		StopSequences: req.StopSequences,
+	}
+	if req.MaxTokens > 0 {
+		reqBody.MaxTokens = req.MaxTokens
+	}
 
-	// Add jitter (±20%)
-	jitter := backoff * (0.8 + 0.4*rand.Float64())
+	// Cache the system prompt, which is usually shared by all requests
+	if req.System != "" {
+		reqBody.System = []ContentBlock{{Type: "text", Text: req.System, CacheControl: ephemeralCache}}
+	}
 
-	return time.Duration(jitter)
+	return reqBody
 }
 
-// makeRequest makes the actual HTTP request to the Anthropic API
-// This would be your existing request code
-func (c *Client) makeRequest(messages []string) (string, error) {
-
-	reqBody := anthropicRequest{
-		Model:     model,
-		Messages:  convertToMessages(messages),
-		MaxTokens: 4096,               // Max output tokens
-		System:    prompts.SDHContext, // Include the system context
-	}
-
-	headers := map[string]string{
+// headers returns the headers of API requests
+func (c *Client) headers() map[string]string {
+	return map[string]string{
 		"x-api-key":         c.apiKey,
 		"anthropic-version": "2023-06-01",
 	}
+}
+
+// makeRequest makes the actual HTTP request to the Anthropic API
+func (c *Client) makeRequest(ctx context.Context, req Request) (*Result, error) {
+	reqBody := c.newAPIRequest(req)
+	headers := c.headers()
 
 	var anthropicResp anthropicResponse
 	err := utils.SendJSONRequest(
+		ctx,
 		c.httpClient,
 		"POST",
-		apiURL,
+		c.endpoint,
 		reqBody,
 		&anthropicResp,
 		headers,
 	)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if anthropicResp.Error.Message != "" {
-		return "", fmt.Errorf("anthropic API error: %s - %s", anthropicResp.Error.Type, anthropicResp.Error.Message)
+		return nil, fmt.Errorf("anthropic API error: %s - %s", anthropicResp.Error.Type, anthropicResp.Error.Message)
 	}
 
 	if len(anthropicResp.Content) == 0 {
-		return "", fmt.Errorf("received empty content from Anthropic API")
+		return nil, fmt.Errorf("received empty content from Anthropic API")
+	}
+
+	// The API reports the resolved model, e.g. a dated snapshot for an alias
+	model := anthropicResp.Model
+	if model == "" {
+		model = c.settings.Model
 	}
 
-	return anthropicResp.Content[0].Text, nil
+	return &Result{
+		Text:       anthropicResp.Content[0].Text,
+		Model:      model,
+		StopReason: anthropicResp.StopReason,
+		Usage:      anthropicResp.Usage,
+	}, nil
 }
 
-// convertToMessages converts an array of strings to an array of Messages with the "user" role
-func convertToMessages(contents []string) []Message {
-	messages := make([]Message, len(contents))
+// makeStreamingRequest makes a streamed HTTP request to the Anthropic API, reading the
+// server-sent events of the response as they arrive
+func (c *Client) makeStreamingRequest(ctx context.Context, req Request, onText func(text string)) (*Result, error) {
+	reqBody := c.newAPIRequest(req)
+	reqBody.Stream = true
 
-	for i, content := range contents {
-		messages[i] = Message{
-			Role:    "user",
-			Content: content,
-		}
+	body, err := utils.SendStreamingRequest(ctx, c.streamClient, "POST", c.endpoint, reqBody, c.headers())
+	if err != nil {
+		return nil, err
 	}
+	defer body.Close()
 
-	return messages
-}
+	result := &Result{Model: c.settings.Model}
+	var text strings.Builder
+	done := false
 
-// estimateTokenCount estimates the number of tokens in a slice of strings
-func estimateTokenCount(texts []string) int {
-	totalTokens := 0
+	err = utils.ReadServerSentEvents(body, func(_, data string) error {
+		var event streamEvent
+		if err := utils.UnmarshalJSON([]byte(data), &event); err != nil {
+			return err
+		}
 
-	for _, text := range texts {
-		if text == "" {
-			continue
+		switch event.Type {
+		case "message_start":
+			// The API reports the resolved model, e.g. a dated snapshot for an alias
+			if event.Message.Model != "" {
+				result.Model = event.Message.Model
+			}
+			result.Usage = event.Message.Usage
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" && event.Delta.Text != "" {
+				text.WriteString(event.Delta.Text)
+				onText(event.Delta.Text)
+			}
+		case "message_delta":
+			// The output tokens are cumulative, the last delta has the total
+			result.StopReason = event.Delta.StopReason
+			result.Usage.OutputTokens = event.Usage.OutputTokens
+		case "message_stop":
+			done = true
+		case "error":
+			return fmt.Errorf("anthropic API error: %s - %s", event.Error.Type, event.Error.Message)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !done {
+		return nil, fmt.Errorf("anthropic API stream ended before the end of the message")
+	}
 
-		// Basic estimation based on character count
-		charCount := len(text)
+	if text.Len() == 0 {
+		return nil, fmt.Errorf("received empty content from Anthropic API")
+	}
+
+	result.Text = text.String()
+	return result, nil
+}
 
-		// Add base tokens plus character-based estimation
-		// Use math.Ceil to round up for a conservative estimate
-		messageTokens := baseTokens + int(math.Ceil(float64(charCount)/avgCharsPerToken))
+// convertToMessages converts messages to their API representation,
+// marking the end of the first `cachePrefix` messages as a cache breakpoint
+func convertToMessages(messages []Message, cachePrefix int) []apiMessage {
+	converted := make([]apiMessage, len(messages))
 
-		totalTokens += messageTokens
+	for i, message := range messages {
+		block := ContentBlock{Type: "text", Text: message.Content}
+		if i == cachePrefix-1 {
+			block.CacheControl = ephemeralCache
+		}
+
+		converted[i] = apiMessage{
+			Role:    message.Role,
+			Content: []ContentBlock{block},
+		}
 	}
 
-	return totalTokens
+	return converted
 }
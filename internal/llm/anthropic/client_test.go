@@ -0,0 +1,154 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sseEvent formats a server-sent event of the Messages API
+func sseEvent(event, data string) string {
+	return fmt.Sprintf("event: %s\ndata: %s\n\n", event, data)
+}
+
+var (
+	messageStart = sseEvent("message_start", `{"type":"message_start","message":{"model":"claude-3-5-haiku-20241022",`+
+		`"usage":{"input_tokens":120,"cache_read_input_tokens":40,"cache_creation_input_tokens":10,"output_tokens":1}}}`)
+	textDelta = func(text string) string {
+		return sseEvent("content_block_delta", fmt.Sprintf(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":%q}}`, text))
+	}
+	messageDelta = sseEvent("message_delta", `{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":25}}`)
+	messageStop  = sseEvent("message_stop", `{"type":"message_stop"}`)
+	ping         = sseEvent("ping", `{"type":"ping"}`)
+)
+
+// TestStream checks the parsing of streamed responses served by a test server
+func TestStream(t *testing.T) {
+	tests := []struct {
+		name       string
+		stream     string
+		wantPieces []string
+		want       *Result
+		wantErr    string
+	}{
+		{
+			name: "complete message",
+			stream: messageStart + sseEvent("content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`) +
+				ping + textDelta("Hello") + textDelta(", world") + sseEvent("content_block_stop", `{"type":"content_block_stop","index":0}`) +
+				messageDelta + messageStop,
+			wantPieces: []string{"Hello", ", world"},
+			want: &Result{
+				Text:       "Hello, world",
+				Model:      "claude-3-5-haiku-20241022",
+				StopReason: "end_turn",
+				Usage:      Usage{InputTokens: 120, OutputTokens: 25, CacheCreationInputTokens: 10, CacheReadInputTokens: 40},
+			},
+		},
+		{
+			name:       "missing message_stop",
+			stream:     messageStart + textDelta("Hello"),
+			wantPieces: []string{"Hello"},
+			wantErr:    "stream ended before the end of the message",
+		},
+		{
+			name:       "error event",
+			stream:     messageStart + textDelta("Hel") + sseEvent("error", `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`),
+			wantPieces: []string{"Hel"},
+			wantErr:    "overloaded_error - Overloaded",
+		},
+		{
+			name:    "empty message",
+			stream:  messageStart + messageDelta + messageStop,
+			wantErr: "received empty content",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+
+				var body map[string]any
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+				if body["stream"] != true {
+					t.Errorf("request stream = %v, want true", body["stream"])
+				}
+
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprint(w, tt.stream)
+			}))
+			defer server.Close()
+
+			client := NewClient("test-key-"+tt.name, Settings{})
+			client.endpoint = server.URL
+
+			var pieces []string
+			result, err := client.Stream(context.Background(), Request{Messages: []Message{{Role: "user", Content: "Hi"}}}, func(text string) {
+				pieces = append(pieces, text)
+			})
+
+			if !reflect.DeepEqual(pieces, tt.wantPieces) {
+				t.Errorf("streamed pieces = %q, want %q", pieces, tt.wantPieces)
+			}
+			// Errors after the response started are not retried, so that no text is streamed twice
+			if requests != 1 {
+				t.Errorf("%d requests, want 1", requests)
+			}
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Stream() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Stream() error = %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.want) {
+				t.Errorf("Stream() = %+v, want %+v", result, tt.want)
+			}
+		})
+	}
+}
+
+// TestStreamRetriesBeforeResponse checks that overloaded responses are retried before streaming starts
+func TestStreamRetriesBeforeResponse(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(529)
+			fmt.Fprint(w, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)
+			return
+		}
+		fmt.Fprint(w, messageStart+textDelta("Hi")+messageDelta+messageStop)
+	}))
+	defer server.Close()
+
+	client := NewClient("test-key-retry", Settings{})
+	client.endpoint = server.URL
+
+	var text strings.Builder
+	result, err := client.Stream(context.Background(), Request{Messages: []Message{{Role: "user", Content: "Hi"}}}, func(piece string) {
+		text.WriteString(piece)
+	})
+	if err != nil {
+		t.Fatalf("Stream() error = %v", err)
+	}
+
+	if requests != 2 {
+		t.Errorf("%d requests, want 2", requests)
+	}
+	if text.String() != "Hi" || result.Text != "Hi" {
+		t.Errorf("streamed %q and returned %q, want %q", text.String(), result.Text, "Hi")
+	}
+}
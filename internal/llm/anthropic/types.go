@@ -1,26 +1,108 @@
 package anthropic
 
+// Request is a conversation sent to the API
+type Request struct {
+	// System is the system prompt, none if empty
+	System   string
+	Messages []Message
+	// StopSequences end the generation when one of them is generated
+	StopSequences []string
+	// MaxTokens overrides the client's maximum number of output tokens when greater than 0
+	MaxTokens int
+	// CachePrefix is the number of leading messages to cache along with the system prompt,
+	// because they are repeated identically by subsequent requests
+	CachePrefix int
+}
+
+// Message is a turn of the conversation, with the "user" or "assistant" role
+type Message struct {
+	Role    string
+	Content string
+}
+
 // anthropicRequest is the JSON structure for the API request.
 type anthropicRequest struct {
-	Model     string    `json:"model"`
-	Messages  []Message `json:"messages"`
-	MaxTokens int       `json:"max_tokens"`
-	System    string    `json:"system,omitempty"`
+	Model         string         `json:"model"`
+	Messages      []apiMessage   `json:"messages"`
+	MaxTokens     int            `json:"max_tokens"`
+	Temperature   *float64       `json:"temperature,omitempty"`
+	System        []ContentBlock `json:"system,omitempty"`
+	StopSequences []string       `json:"stop_sequences,omitempty"`
+	Stream        bool           `json:"stream,omitempty"`
 }
 
-// Message represents a single message in the conversation.
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+// apiMessage represents a single message in the conversation.
+type apiMessage struct {
+	Role    string         `json:"role"`
+	Content []ContentBlock `json:"content"`
+}
+
+// ContentBlock is a text block of a message or of the system prompt
+type ContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+	// CacheControl marks the end of a prompt prefix to cache, nil if the prefix is not cached
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+}
+
+// CacheControl configures the caching of a prompt prefix
+type CacheControl struct {
+	Type string `json:"type"`
 }
 
+// ephemeralCache caches a prompt prefix for a few minutes, refreshed each time it is used
+var ephemeralCache = &CacheControl{Type: "ephemeral"}
+
 // anthropicResponse is the JSON structure for the API response.
 type anthropicResponse struct {
 	Content []struct {
 		Text string `json:"text"`
 	} `json:"content"`
+	Model      string `json:"model"`
+	StopReason string `json:"stop_reason"`
+	Usage      Usage  `json:"usage"`
+	Error      struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// streamEvent is the JSON structure of the server-sent events of a streamed response
+type streamEvent struct {
+	Type string `json:"type"`
+	// Message is sent by "message_start" events, with the usage of the input tokens
+	Message struct {
+		Model string `json:"model"`
+		Usage Usage  `json:"usage"`
+	} `json:"message"`
+	// Delta is the generated text of "content_block_delta" events and the stop reason of "message_delta" events
+	Delta struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	// Usage is sent by "message_delta" events, with the number of output tokens generated so far
+	Usage Usage `json:"usage"`
 	Error struct {
 		Type    string `json:"type"`
 		Message string `json:"message"`
 	} `json:"error"`
 }
+
+// Usage is the number of tokens billed for a request, as reported by the API.
+// InputTokens excludes the tokens written to or read from the prompt cache.
+type Usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// Result is the generated text of a request along with the model that generated it, why it stopped
+// (e.g. "end_turn", "max_tokens" or "stop_sequence") and its token usage
+type Result struct {
+	Text       string
+	Model      string
+	StopReason string
+	Usage      Usage
+}
@@ -2,17 +2,186 @@
 package llm
 
 import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
 	"sdh-agent/internal/llm/anthropic"
+	"sdh-agent/internal/llm/openai"
 )
 
+// DefaultProvider is the provider used when none is configured
+const DefaultProvider = "anthropic"
+
 // Client defines the interface for any LLM provider
 type Client interface {
-	// GenerateText sends a prompt with `messages` to the LLM and returns generated text
-	GenerateText(messages []string) (string, error)
+	// Generate sends a prompt to the LLM and returns the generated text with the tokens used
+	Generate(ctx context.Context, req Request) (*Response, error)
+}
+
+// Streamer is implemented by clients able to stream the generated text as it is generated
+type Streamer interface {
+	// Stream generates a response like Generate, calling `onText` with each piece of text as it is generated
+	Stream(ctx context.Context, req Request, onText func(text string)) (*Response, error)
+}
+
+// Stream generates a response, calling `onText` with each piece of text as it is generated.
+// The text of clients that do not support streaming is passed to `onText` at once when complete.
+func Stream(ctx context.Context, client Client, req Request, onText func(text string)) (*Response, error) {
+	if streamer, ok := client.(Streamer); ok {
+		return streamer.Stream(ctx, req, onText)
+	}
+
+	response, err := client.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	onText(response.Text)
+	return response, nil
+}
+
+// Roles of the messages of a conversation
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is a turn of a conversation
+type Message struct {
+	Role    string
+	Content string
+}
+
+// UserMessages converts each content to a message with the user role
+func UserMessages(contents ...string) []Message {
+	messages := make([]Message, len(contents))
+	for i, content := range contents {
+		messages[i] = Message{Role: RoleUser, Content: content}
+	}
+	return messages
+}
+
+// Request is a conversation sent to an LLM
+type Request struct {
+	// System is the system prompt, none if empty
+	System   string
+	Messages []Message
+	// StopSequences end the generation when one of them is generated
+	StopSequences []string
+	// MaxTokens overrides the client's maximum number of output tokens when greater than 0
+	MaxTokens int
+	// CachePrefix is the number of leading messages repeated identically by other requests of the run
+	// (e.g. the main issue summary of relevance checks), which providers supporting prompt caching
+	// cache along with the system prompt
+	CachePrefix int
+}
+
+// Response is the generated text of a call along with the model that generated it and its usage
+type Response struct {
+	Text  string
+	Model string
+	// StopReason is the provider's reason for ending the generation, e.g. "end_turn" or "max_tokens"
+	StopReason string
+	Usage      Usage
+}
+
+// GenerateText is a convenience wrapper sending `messages` as consecutive user messages,
+// without system prompt, and returning only the generated text
+func GenerateText(ctx context.Context, client Client, messages []string) (string, error) {
+	response, err := client.Generate(ctx, Request{Messages: UserMessages(messages...)})
+	if err != nil {
+		return "", err
+	}
+	return response.Text, nil
+}
+
+// Embedder defines the interface for providers that compute text embeddings
+type Embedder interface {
+	// Embed returns one embedding vector per text, in the same order as `texts`
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// EmbeddingConfig holds the settings needed to create an embedder.
+// Embeddings are computed through any OpenAI-compatible embeddings API.
+type EmbeddingConfig struct {
+	APIKey  string
+	BaseURL string
+	Model   string
+}
+
+// Config holds the settings needed to create an LLM client
+type Config struct {
+	// Provider is the name of a registered provider (e.g. "anthropic" or "openai")
+	Provider string
+	APIKey   string
+	// BaseURL overrides the provider's default API endpoint
+	BaseURL string
+	// Model overrides the provider's default model
+	Model string
+	// MaxTokens overrides the provider's default maximum number of output tokens
+	MaxTokens int
+	// Temperature overrides the provider's default sampling temperature
+	Temperature *float64
+	// RetryBackoff overrides the provider's default first delay between retries
+	RetryBackoff time.Duration
+}
+
+// Factory creates a client for a provider
+type Factory func(cfg Config) (Client, error)
+
+// providers maps provider names to their factories
+var providers = map[string]Factory{
+	"anthropic": func(cfg Config) (Client, error) {
+		return &anthropicClient{anthropic.NewClient(cfg.APIKey, anthropic.Settings{
+			Model:       cfg.Model,
+			MaxTokens:   cfg.MaxTokens,
+			Temperature: cfg.Temperature,
+			BaseBackoff: cfg.RetryBackoff,
+		})}, nil
+	},
+	"openai": func(cfg Config) (Client, error) {
+		return &openaiClient{openai.NewClient(cfg.APIKey, cfg.BaseURL, openai.Settings{
+			Model:       cfg.Model,
+			MaxTokens:   cfg.MaxTokens,
+			Temperature: cfg.Temperature,
+			BaseBackoff: cfg.RetryBackoff,
+		})}, nil
+	},
+}
+
+// Register makes a provider available under `name`, replacing any provider with the same name
+func Register(name string, factory Factory) {
+	providers[strings.ToLower(name)] = factory
+}
+
+// Providers returns the names of all registered providers in alphabetical order
+func Providers() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // NewClient creates a new LLM client based on the provider type
-func NewClient(apiKey string) Client {
-	// For now, default to Anthropic
-	return anthropic.NewClient(apiKey)
+func NewClient(cfg Config) (Client, error) {
+	name := strings.ToLower(cfg.Provider)
+	if name == "" {
+		name = DefaultProvider
+	}
+
+	factory, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown LLM provider %q (available: %s)", cfg.Provider, strings.Join(Providers(), ", "))
+	}
+
+	return factory(cfg)
+}
+
+// NewEmbedder creates a new embedder using an OpenAI-compatible embeddings API
+func NewEmbedder(cfg EmbeddingConfig) Embedder {
+	return openai.NewClient(cfg.APIKey, cfg.BaseURL, openai.Settings{Model: cfg.Model})
 }
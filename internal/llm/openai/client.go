@@ -0,0 +1,210 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"sdh-agent/pkg/utils"
+)
+
+const (
+	// defaultBaseURL is the OpenAI API endpoint. Any OpenAI-compatible server
+	// (internal gateways, Ollama, llama.cpp, ...) can be used by overriding it.
+	defaultBaseURL   = "https://api.openai.com/v1"
+	defaultModel     = "gpt-4o-mini"
+	defaultMaxTokens = 4096 // Max output tokens
+
+	// defaultBaseBackoff is the first retry delay when the server does not send a Retry-After header
+	defaultBaseBackoff = 5 * time.Second
+)
+
+// Settings holds the generation settings of a client
+type Settings struct {
+	// Model defaults to `defaultModel` when empty
+	Model string
+	// MaxTokens defaults to `defaultMaxTokens` when 0
+	MaxTokens int
+	// Temperature uses the server default when nil
+	Temperature *float64
+	// BaseBackoff is the first retry delay, doubled on each retry, defaults to `defaultBaseBackoff` when 0
+	BaseBackoff time.Duration
+}
+
+// Client is a wrapper for OpenAI-compatible chat completions APIs
+type Client struct {
+	apiKey     string
+	baseURL    string
+	settings   Settings
+	httpClient *http.Client
+	// Backoff configuration
+	maxRetries  int
+	baseBackoff time.Duration
+}
+
+// NewClient creates a new OpenAI-compatible API client.
+// `apiKey` may be empty for servers that do not require authentication.
+func NewClient(apiKey, baseURL string, settings Settings) *Client {
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	if settings.Model == "" {
+		settings.Model = defaultModel
+	}
+	if settings.MaxTokens <= 0 {
+		settings.MaxTokens = defaultMaxTokens
+	}
+	if settings.BaseBackoff <= 0 {
+		settings.BaseBackoff = defaultBaseBackoff
+	}
+
+	return &Client{
+		apiKey:      apiKey,
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		settings:    settings,
+		httpClient:  utils.CreateDefaultHTTPClient(),
+		maxRetries:  5,
+		baseBackoff: settings.BaseBackoff,
+	}
+}
+
+// Generate sends a request to the chat completions API and returns the generated text with its token usage
+func (c *Client) Generate(ctx context.Context, req Request) (*Result, error) {
+	// Attempt request with retries and exponential backoff
+	var lastErr error
+	for attempt := 0; attempt < c.maxRetries; attempt++ {
+		result, err := c.makeRequest(ctx, req)
+		if err == nil {
+			return result, nil
+		}
+
+		// Only rate limit errors are retried
+		if !utils.IsRetryableStatus(err, http.StatusTooManyRequests) {
+			return nil, err
+		}
+
+		lastErr = err
+		delay, ok := utils.RetryDelay(err, c.baseBackoff, attempt)
+		if !ok {
+			return nil, fmt.Errorf("API asked to retry in %s, giving up: %w", delay.Round(time.Second), err)
+		}
+		if err := utils.Sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+
+	// All retries failed
+	return nil, fmt.Errorf("max retries exceeded: %w", lastErr)
+}
+
+// makeRequest makes the actual HTTP request to the chat completions endpoint
+func (c *Client) makeRequest(ctx context.Context, req Request) (*Result, error) {
+	reqBody := chatRequest{
+		Model:       c.settings.Model,
+		Messages:    convertToMessages(req.System, req.Messages),
+		MaxTokens:   c.settings.MaxTokens,
+		Temperature: c.settings.Temperature,
+		Stop:        req.StopSequences,
+	}
+	if req.MaxTokens > 0 {
+		reqBody.MaxTokens = req.MaxTokens
+	}
+
+	headers := map[string]string{}
+	if c.apiKey != "" {
+		headers["Authorization"] = "Bearer " + c.apiKey
+	}
+
+	var chatResp chatResponse
+	err := utils.SendJSONRequest(
+		ctx,
+		c.httpClient,
+		"POST",
+		c.baseURL+"/chat/completions",
+		reqBody,
+		&chatResp,
+		headers,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if chatResp.Error != nil {
+		return nil, fmt.Errorf("openai API error: %s - %s", chatResp.Error.Type, chatResp.Error.Message)
+	}
+
+	if len(chatResp.Choices) == 0 {
+		return nil, fmt.Errorf("received no choices from chat completions API")
+	}
+
+	model := chatResp.Model
+	if model == "" {
+		model = c.settings.Model
+	}
+
+	return &Result{
+		Text:         chatResp.Choices[0].Message.Content,
+		Model:        model,
+		FinishReason: chatResp.Choices[0].FinishReason,
+		Usage:        chatResp.Usage,
+	}, nil
+}
+
+// convertToMessages prepends the system prompt, if any, to the messages as a "system" message
+func convertToMessages(system string, messages []Message) []Message {
+	if system == "" {
+		return messages
+	}
+
+	converted := make([]Message, 0, len(messages)+1)
+	converted = append(converted, Message{Role: "system", Content: system})
+	return append(converted, messages...)
+}
+
+// Embed computes an embedding vector for each text using the embeddings endpoint and the client's model
+func (c *Client) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	reqBody := embeddingRequest{
+		Model: c.settings.Model,
+		Input: texts,
+	}
+
+	headers := map[string]string{}
+	if c.apiKey != "" {
+		headers["Authorization"] = "Bearer " + c.apiKey
+	}
+
+	var embeddingResp embeddingResponse
+	err := utils.SendJSONRequest(
+		ctx,
+		c.httpClient,
+		"POST",
+		c.baseURL+"/embeddings",
+		reqBody,
+		&embeddingResp,
+		headers,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if embeddingResp.Error != nil {
+		return nil, fmt.Errorf("openai API error: %s - %s", embeddingResp.Error.Type, embeddingResp.Error.Message)
+	}
+
+	if len(embeddingResp.Data) != len(texts) {
+		return nil, fmt.Errorf("received %d embeddings for %d texts", len(embeddingResp.Data), len(texts))
+	}
+
+	// Results are not guaranteed to be in input order
+	embeddings := make([][]float32, len(texts))
+	for _, data := range embeddingResp.Data {
+		if data.Index < 0 || data.Index >= len(texts) {
+			return nil, fmt.Errorf("received embedding with out of range index %d", data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
+	}
+
+	return embeddings, nil
+}
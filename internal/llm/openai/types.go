@@ -0,0 +1,80 @@
+package openai
+
+// Request is a conversation sent to the chat completions API
+type Request struct {
+	// System is the system prompt, none if empty
+	System   string
+	Messages []Message
+	// StopSequences end the generation when one of them is generated
+	StopSequences []string
+	// MaxTokens overrides the client's maximum number of output tokens when greater than 0
+	MaxTokens int
+}
+
+// chatRequest is the JSON structure for the chat completions request.
+type chatRequest struct {
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	Stop        []string  `json:"stop,omitempty"`
+}
+
+// Message represents a single message in the conversation, with the "system", "user" or "assistant" role.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// embeddingRequest is the JSON structure for the embeddings request.
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// embeddingResponse is the JSON structure for the embeddings response.
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// chatResponse is the JSON structure for the chat completions response.
+type chatResponse struct {
+	Choices []struct {
+		Message      Message `json:"message"`
+		FinishReason string  `json:"finish_reason"`
+	} `json:"choices"`
+	Model string `json:"model"`
+	Usage Usage  `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Usage is the number of tokens billed for a request, as reported by the server.
+// Some OpenAI-compatible servers do not report it, leaving it zero.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	// PromptTokensDetails reports the prompt tokens read from the server's automatic prompt cache,
+	// which are included in PromptTokens
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+}
+
+// Result is the generated text of a request along with the model that generated it, why it stopped
+// (e.g. "stop" or "length") and its token usage
+type Result struct {
+	Text         string
+	Model        string
+	FinishReason string
+	Usage        Usage
+}
@@ -0,0 +1,89 @@
+package llm
+
+import (
+	"log"
+	"strings"
+	"sync"
+)
+
+const (
+	// Prices of prompt cache writes and reads relative to the input price, unless set for a model
+	cacheWritePriceFactor = 1.25
+	cacheReadPriceFactor  = 0.1
+)
+
+// Price is the cost of a model in US dollars per million tokens
+type Price struct {
+	Input  float64
+	Output float64
+	// CacheWrite and CacheRead default to the input price times
+	// `cacheWritePriceFactor` and `cacheReadPriceFactor` when 0
+	CacheWrite float64
+	CacheRead  float64
+}
+
+// Cost returns the cost of a usage in US dollars
+func (p Price) Cost(usage Usage) float64 {
+	cacheWrite, cacheRead := p.CacheWrite, p.CacheRead
+	if cacheWrite == 0 {
+		cacheWrite = p.Input * cacheWritePriceFactor
+	}
+	if cacheRead == 0 {
+		cacheRead = p.Input * cacheReadPriceFactor
+	}
+
+	return (float64(usage.InputTokens)*p.Input +
+		float64(usage.CacheWriteTokens)*cacheWrite +
+		float64(usage.CacheReadTokens)*cacheRead +
+		float64(usage.OutputTokens)*p.Output) / 1_000_000
+}
+
+// prices maps model name prefixes to their list prices, the longest matching prefix wins
+// so that dated snapshots (e.g. claude-3-5-haiku-20241022) and aliases share a price
+var prices = map[string]Price{
+	// Anthropic
+	"claude-3-haiku":    {Input: 0.25, Output: 1.25},
+	"claude-3-5-haiku":  {Input: 0.80, Output: 4},
+	"claude-haiku-4-5":  {Input: 1, Output: 5},
+	"claude-3-5-sonnet": {Input: 3, Output: 15},
+	"claude-3-7-sonnet": {Input: 3, Output: 15},
+	"claude-sonnet-4":   {Input: 3, Output: 15},
+	"claude-3-opus":     {Input: 15, Output: 75},
+	"claude-opus-4":     {Input: 15, Output: 75},
+	"claude-opus-4-5":   {Input: 5, Output: 25},
+
+	// OpenAI, whose prompt caching is automatic and discounts cached input tokens
+	"gpt-4o":       {Input: 2.50, Output: 10, CacheRead: 1.25},
+	"gpt-4o-mini":  {Input: 0.15, Output: 0.60, CacheRead: 0.075},
+	"gpt-4.1":      {Input: 2, Output: 8, CacheRead: 0.50},
+	"gpt-4.1-mini": {Input: 0.40, Output: 1.60, CacheRead: 0.10},
+	"gpt-4.1-nano": {Input: 0.10, Output: 0.40, CacheRead: 0.025},
+}
+
+// unpricedModels records the models without a price that were already reported
+var unpricedModels sync.Map
+
+// PriceFor returns the price of a model, and false if it is not in the pricing table
+// (e.g. self-hosted models, whose cost is then counted as zero)
+func PriceFor(model string) (Price, bool) {
+	var price Price
+	matched := ""
+	for prefix, p := range prices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(matched) {
+			price, matched = p, prefix
+		}
+	}
+	return price, matched != ""
+}
+
+// costOf returns the cost of a call to `model`, logging once per model when its price is unknown
+func costOf(model string, usage Usage) float64 {
+	price, ok := PriceFor(model)
+	if !ok {
+		if _, reported := unpricedModels.LoadOrStore(model, true); !reported {
+			log.Printf("No pricing known for LLM model %q, its cost is counted as zero", model)
+		}
+		return 0
+	}
+	return price.Cost(usage)
+}
@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"context"
+
+	"sdh-agent/internal/llm/anthropic"
+	"sdh-agent/internal/llm/openai"
+	"sdh-agent/pkg/utils"
+)
+
+// anthropicClient adapts the Anthropic client to the Client interface
+type anthropicClient struct {
+	client *anthropic.Client
+}
+
+// Generate implements Client
+func (c *anthropicClient) Generate(ctx context.Context, req Request) (*Response, error) {
+	result, err := c.client.Generate(ctx, toAnthropicRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	return fromAnthropicResult(result), nil
+}
+
+// Stream implements Streamer
+func (c *anthropicClient) Stream(ctx context.Context, req Request, onText func(text string)) (*Response, error) {
+	result, err := c.client.Stream(ctx, toAnthropicRequest(req), onText)
+	if err != nil {
+		return nil, err
+	}
+	return fromAnthropicResult(result), nil
+}
+
+// toAnthropicRequest converts a request to its Anthropic representation
+func toAnthropicRequest(req Request) anthropic.Request {
+	messages := make([]anthropic.Message, len(req.Messages))
+	for i, message := range req.Messages {
+		messages[i] = anthropic.Message{Role: message.Role, Content: message.Content}
+	}
+
+	return anthropic.Request{
+		System:        req.System,
+		Messages:      messages,
+		StopSequences: req.StopSequences,
+		MaxTokens:     req.MaxTokens,
+		CachePrefix:   req.CachePrefix,
+	}
+}
+
+// fromAnthropicResult converts an Anthropic result to a response, pricing its usage
+func fromAnthropicResult(result *anthropic.Result) *Response {
+	usage := Usage{
+		InputTokens:      result.Usage.InputTokens,
+		OutputTokens:     result.Usage.OutputTokens,
+		CacheWriteTokens: result.Usage.CacheCreationInputTokens,
+		CacheReadTokens:  result.Usage.CacheReadInputTokens,
+		Calls:            1,
+	}
+	usage.Cost = costOf(result.Model, usage)
+
+	return &Response{Text: result.Text, Model: result.Model, StopReason: result.StopReason, Usage: usage}
+}
+
+// openaiClient adapts the OpenAI-compatible client to the Client interface
+type openaiClient struct {
+	client *openai.Client
+}
+
+// Generate implements Client. Caching is automatic with OpenAI, so the cache prefix is ignored.
+func (c *openaiClient) Generate(ctx context.Context, req Request) (*Response, error) {
+	messages := make([]openai.Message, len(req.Messages))
+	for i, message := range req.Messages {
+		messages[i] = openai.Message{Role: message.Role, Content: message.Content}
+	}
+
+	result, err := c.client.Generate(ctx, openai.Request{
+		System:        req.System,
+		Messages:      messages,
+		StopSequences: req.StopSequences,
+		MaxTokens:     req.MaxTokens,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cached := result.Usage.PromptTokensDetails.CachedTokens
+	usage := Usage{
+		InputTokens:     result.Usage.PromptTokens - cached,
+		OutputTokens:    result.Usage.CompletionTokens,
+		CacheReadTokens: cached,
+		Calls:           1,
+	}
+
+	// Fall back to estimates for servers that do not report usage
+	if usage.TotalTokens() == 0 {
+		texts := []string{req.System}
+		for _, message := range req.Messages {
+			texts = append(texts, message.Content)
+		}
+		usage.InputTokens = utils.EstimateTokenCount(texts)
+		usage.OutputTokens = utils.EstimateTokenCount([]string{result.Text})
+	}
+	usage.Cost = costOf(result.Model, usage)
+
+	return &Response{Text: result.Text, Model: result.Model, StopReason: result.FinishReason, Usage: usage}, nil
+}
@@ -0,0 +1,164 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Usage counts the tokens consumed by LLM calls and their cost in US dollars
+type Usage struct {
+	// InputTokens excludes the input tokens written to or read from the prompt cache
+	InputTokens      int
+	OutputTokens     int
+	CacheWriteTokens int
+	CacheReadTokens  int
+	Calls            int
+	Cost             float64
+}
+
+// TotalTokens returns the sum of input, cached input and output tokens
+func (u Usage) TotalTokens() int {
+	return u.InputTokens + u.CacheWriteTokens + u.CacheReadTokens + u.OutputTokens
+}
+
+// Add returns the sum of two usages
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		InputTokens:      u.InputTokens + other.InputTokens,
+		OutputTokens:     u.OutputTokens + other.OutputTokens,
+		CacheWriteTokens: u.CacheWriteTokens + other.CacheWriteTokens,
+		CacheReadTokens:  u.CacheReadTokens + other.CacheReadTokens,
+		Calls:            u.Calls + other.Calls,
+		Cost:             u.Cost + other.Cost,
+	}
+}
+
+// String summarizes the usage, e.g. "3 LLM calls, 1200 input tokens (4000 cache reads, 2000 cache writes), 300 output tokens, $0.0021"
+func (u Usage) String() string {
+	cache := ""
+	if u.CacheReadTokens > 0 || u.CacheWriteTokens > 0 {
+		cache = fmt.Sprintf(" (%d cache reads, %d cache writes)", u.CacheReadTokens, u.CacheWriteTokens)
+	}
+	return fmt.Sprintf("%d LLM calls, %d input tokens%s, %d output tokens, $%.4f", u.Calls, u.InputTokens, cache, u.OutputTokens, u.Cost)
+}
+
+// ErrBudgetExceeded is returned for LLM calls made after the budget of their run is exhausted
+var ErrBudgetExceeded = errors.New("LLM budget exceeded")
+
+// Budget limits the LLM usage of a run, zero fields mean no limit
+type Budget struct {
+	// MaxCost is the maximum cost in US dollars
+	MaxCost float64
+	// MaxTokens is the maximum number of input and output tokens
+	MaxTokens int
+}
+
+// UsageMeter accumulates the usage of all LLM calls of a run and enforces its budget.
+// It is safe for concurrent use.
+type UsageMeter struct {
+	mu     sync.Mutex
+	usage  Usage
+	budget Budget
+	// parent also records the usage, e.g. the meter of a whole batch, may be nil
+	parent *UsageMeter
+}
+
+// NewUsageMeter creates a meter enforcing `budget` that also records usage in `parent`, which may be nil
+func NewUsageMeter(budget Budget, parent *UsageMeter) *UsageMeter {
+	return &UsageMeter{budget: budget, parent: parent}
+}
+
+// Record adds the usage of a call to the meter
+func (m *UsageMeter) Record(usage Usage) {
+	m.mu.Lock()
+	m.usage = m.usage.Add(usage)
+	m.mu.Unlock()
+
+	if m.parent != nil {
+		m.parent.Record(usage)
+	}
+}
+
+// Total returns the usage accumulated so far
+func (m *UsageMeter) Total() Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage
+}
+
+// BudgetUsed returns the fraction of the budget used so far (1 or more once it is exhausted),
+// or 0 if the meter has no budget
+func (m *UsageMeter) BudgetUsed() float64 {
+	usage := m.Total()
+
+	used := 0.0
+	if m.budget.MaxCost > 0 {
+		used = max(used, usage.Cost/m.budget.MaxCost)
+	}
+	if m.budget.MaxTokens > 0 {
+		used = max(used, float64(usage.TotalTokens())/float64(m.budget.MaxTokens))
+	}
+	return used
+}
+
+// usageMeterKey is the context key of the usage meter of a run
+type usageMeterKey struct{}
+
+// WithUsageMeter returns a context whose LLM calls are recorded in `meter`
+func WithUsageMeter(ctx context.Context, meter *UsageMeter) context.Context {
+	return context.WithValue(ctx, usageMeterKey{}, meter)
+}
+
+// UsageMeterFrom returns the usage meter attached to the context, or nil if there is none
+func UsageMeterFrom(ctx context.Context) *UsageMeter {
+	meter, _ := ctx.Value(usageMeterKey{}).(*UsageMeter)
+	return meter
+}
+
+// meteredClient records the usage of each call of the wrapped client in the usage meter of the call's context
+type meteredClient struct {
+	client Client
+}
+
+// Metered wraps a client so that its calls are recorded in the usage meter attached to their context,
+// and refused once the budget of the meter is exhausted
+func Metered(client Client) Client {
+	return &meteredClient{client: client}
+}
+
+// Generate calls the wrapped client and records the usage of the call
+func (c *meteredClient) Generate(ctx context.Context, req Request) (*Response, error) {
+	return c.record(ctx, func() (*Response, error) {
+		return c.client.Generate(ctx, req)
+	})
+}
+
+// Stream streams the response of the wrapped client and records the usage of the call
+func (c *meteredClient) Stream(ctx context.Context, req Request, onText func(text string)) (*Response, error) {
+	return c.record(ctx, func() (*Response, error) {
+		return Stream(ctx, c.client, req, onText)
+	})
+}
+
+// record makes a call unless the budget is exhausted, and records its usage
+func (c *meteredClient) record(ctx context.Context, call func() (*Response, error)) (*Response, error) {
+	meter := UsageMeterFrom(ctx)
+	if meter != nil && meter.BudgetUsed() >= 1 {
+		return nil, fmt.Errorf("%w (%s)", ErrBudgetExceeded, meter.Total())
+	}
+
+	response, err := call()
+
+	if meter != nil {
+		// Failed calls are counted but are not billed
+		usage := Usage{Calls: 1}
+		if err == nil {
+			usage = response.Usage
+		}
+		meter.Record(usage)
+	}
+
+	return response, err
+}
@@ -49,21 +49,29 @@ SDH issue summary:
 %s`, summary)
 }
 
-// CreateRelevanceAnalysisPrompt creates a prompt for comparing issues
-func CreateRelevanceAnalysisPrompt(mainIssueNumber, otherIssueNumber int) string {
+// CreateRelevanceAnalysisPrompt creates a prompt for comparing issues. It does not depend on the other issue,
+// so that it can be cached along with the main issue summary across the relevance checks of a run.
+func CreateRelevanceAnalysisPrompt(mainIssueNumber int) string {
 	return fmt.Sprintf(`You have been assigned GitHub SDH issue #%d. 
-There is another SDH issue (#%d) that can potentially be related to the current issue.
+There is another SDH issue that can potentially be related to the current issue.
 Analyze the content of both issues and determine if the other issue contains relevant information to help resolve the current issue.
 
-Answer with:
-1. RELEVANT: true/false
-2. If relevant, provide a summary of how this issue was resolved and what insights it provides.
-
 The content of both SDH issues will be provided in the next two messages.
 
-Format your response as follows with no additional text or formatting:
-RELEVANT: [true/false]
-RESOLUTION: [result of your analyzis if relevant, or "N/A" if not relevant]`, mainIssueNumber, otherIssueNumber)
+Respond with a single JSON object and no additional text or formatting, using exactly these fields:
+{
+  "relevant": true or false,
+  "confidence": a number between 0 and 1 expressing how confident you are in your answer,
+  "resolution": "if relevant, a summary of how the other issue was resolved and what insights it provides; otherwise \"N/A\"",
+  "key_evidence": ["facts shared by both issues that support your answer (e.g. identical error messages)"],
+  "fix_references": ["PRs, commits, documentation links or issues referenced by the fix, or an empty list"]
+}`, mainIssueNumber)
+}
+
+// CreateRelevanceRepairPrompt creates a prompt asking the LLM to fix a malformed relevance analysis.
+func CreateRelevanceRepairPrompt(validationError string) string {
+	return fmt.Sprintf(`Your previous response could not be parsed: %s.
+Respond again with only the JSON object in the format requested above, with no additional text, explanations or code fences.`, validationError)
 }
 
 // CreateReportGenerationPrompt creates the final prompt to generate the full analysis report.
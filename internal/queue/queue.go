@@ -0,0 +1,405 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Job statuses
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// leaseDuration is how long a claimed job stays reserved to its worker without the lease being renewed.
+// Jobs whose lease expired were abandoned by a crashed process and can be claimed again by any process.
+const leaseDuration = 5 * time.Minute
+
+// ErrLeaseLost is returned when a job was reclaimed or retried by another process while it was running
+var ErrLeaseLost = errors.New("job lease lost")
+
+// jobsBucket is the bucket holding jobs keyed by job ID
+var jobsBucket = []byte("jobs")
+
+// Job is an analysis run of an SDH issue
+type Job struct {
+	// ID identifies the job, there is at most one job per issue
+	ID          string    `json:"id"`
+	Owner       string    `json:"owner"`
+	Repo        string    `json:"repo"`
+	IssueNumber int       `json:"issue_number"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	// NextAttemptAt delays retries of pending jobs
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	// LeaseExpiresAt is when a running job is considered abandoned unless its worker renews the lease
+	LeaseExpiresAt time.Time `json:"lease_expires_at"`
+	// Rerun schedules a running job again once it ends, e.g. when a refresh was requested during the run
+	Rerun bool `json:"rerun,omitempty"`
+}
+
+// leaseExpired reports whether the job is running but its worker stopped renewing the lease
+func (job *Job) leaseExpired(now time.Time) bool {
+	return job.Status == StatusRunning && !job.LeaseExpiresAt.After(now)
+}
+
+// Queue is a durable on-disk job queue.
+// The database is only held open for the duration of each operation so that
+// the queue can be inspected from another process while workers are running.
+type Queue struct {
+	path string
+	// wake notifies idle workers of this process that a job was enqueued
+	wake chan struct{}
+}
+
+// Open creates the queue database at `path` if needed and returns the queue
+func Open(path string) (*Queue, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory: %w", err)
+	}
+
+	q := &Queue{path: path, wake: make(chan struct{}, 1)}
+	err := q.update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(jobsBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize job queue: %w", err)
+	}
+
+	return q, nil
+}
+
+// JobID builds the ID of the job analyzing an issue
+func JobID(owner, repo string, issueNumber int) string {
+	return fmt.Sprintf("%s/%s#%d", owner, repo, issueNumber)
+}
+
+// Enqueue schedules the analysis of an issue. If a job for the issue is already pending or running
+// it is returned unchanged and `created` is false; finished jobs are scheduled again.
+func (q *Queue) Enqueue(owner, repo string, issueNumber int) (job *Job, created bool, err error) {
+	return q.enqueue(owner, repo, issueNumber, false)
+}
+
+// EnqueueRerun is like Enqueue, but a running job of the issue is marked to run again once it ends,
+// so that the analysis takes changes made to the issue during the run into account
+func (q *Queue) EnqueueRerun(owner, repo string, issueNumber int) (job *Job, created bool, err error) {
+	return q.enqueue(owner, repo, issueNumber, true)
+}
+
+// enqueue schedules the analysis of an issue, marking a running job to run again if `rerun` is set
+func (q *Queue) enqueue(owner, repo string, issueNumber int, rerun bool) (job *Job, created bool, err error) {
+	id := JobID(owner, repo, issueNumber)
+
+	err = q.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(jobsBucket)
+
+		existing, err := getJob(bucket, id)
+		if err != nil {
+			return err
+		}
+		if existing != nil && (existing.Status == StatusPending || existing.Status == StatusRunning) {
+			job = existing
+			if rerun && job.Status == StatusRunning && !job.Rerun {
+				job.Rerun = true
+				return putJob(bucket, job)
+			}
+			return nil
+		}
+
+		now := time.Now().UTC()
+		job = &Job{
+			ID:          id,
+			Owner:       owner,
+			Repo:        repo,
+			IssueNumber: issueNumber,
+			Status:      StatusPending,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		created = true
+		return putJob(bucket, job)
+	})
+
+	if created {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	return job, created, err
+}
+
+// Claim marks the oldest pending job that is due, or running job whose lease expired, as running
+// and returns it, or nil if there is none. The job is leased to the caller for `leaseDuration`.
+// Jobs whose lease expired after `maxAttempts` attempts (e.g. because they crash their worker)
+// are marked as failed instead of being claimed again.
+func (q *Queue) Claim(maxAttempts int) (*Job, error) {
+	var claimed *Job
+
+	err := q.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(jobsBucket)
+		now := time.Now().UTC()
+
+		var abandoned []*Job
+		err := bucket.ForEach(func(_, data []byte) error {
+			var job Job
+			if err := json.Unmarshal(data, &job); err != nil {
+				return err
+			}
+			due := job.Status == StatusPending && !job.NextAttemptAt.After(now)
+			if !due && !job.leaseExpired(now) {
+				return nil
+			}
+			if !due && job.Attempts >= maxAttempts {
+				abandoned = append(abandoned, &job)
+				return nil
+			}
+			if claimed == nil || job.CreatedAt.Before(claimed.CreatedAt) {
+				claimed = &job
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, job := range abandoned {
+			log.Printf("Job %s failed: lease expired after %d attempts", job.ID, job.Attempts)
+			job.Status = StatusFailed
+			job.LastError = fmt.Sprintf("lease expired after %d attempts, the job may crash its worker", job.Attempts)
+			job.UpdatedAt = now
+			job.LeaseExpiresAt = time.Time{}
+			if err := putJob(bucket, job); err != nil {
+				return err
+			}
+		}
+
+		if claimed == nil {
+			return nil
+		}
+
+		if claimed.Status == StatusRunning {
+			log.Printf("Reclaiming job %s, abandoned by its worker since %s", claimed.ID, claimed.LeaseExpiresAt.Format(time.RFC3339))
+		}
+
+		// The new run covers reruns requested before it
+		claimed.Status = StatusRunning
+		claimed.Rerun = false
+		claimed.Attempts++
+		claimed.UpdatedAt = now
+		claimed.LeaseExpiresAt = now.Add(leaseDuration)
+		return putJob(bucket, claimed)
+	})
+
+	return claimed, err
+}
+
+// Renew extends the lease of a running job, returning ErrLeaseLost if the job was reclaimed
+// or retried by another process in the meantime
+func (q *Queue) Renew(job *Job) error {
+	var renewed *Job
+
+	err := q.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(jobsBucket)
+
+		var err error
+		if renewed, err = checkLease(bucket, job.ID, job.LeaseExpiresAt); err != nil {
+			return err
+		}
+
+		// Update the stored job rather than `job`, to keep changes made by other processes (e.g. Rerun)
+		now := time.Now().UTC()
+		renewed.UpdatedAt = now
+		renewed.LeaseExpiresAt = now.Add(leaseDuration)
+		return putJob(bucket, renewed)
+	})
+	if err != nil {
+		return err
+	}
+
+	job.UpdatedAt, job.LeaseExpiresAt = renewed.UpdatedAt, renewed.LeaseExpiresAt
+	return nil
+}
+
+// Complete records the outcome of a running job. Failed jobs are scheduled again after `retryAfter`
+// when `retry` is true, and marked as failed otherwise. Jobs marked to run again are scheduled immediately
+// whatever their outcome. ErrLeaseLost is returned without recording anything if the job was reclaimed
+// or retried by another process.
+func (q *Queue) Complete(job *Job, runErr error, retry bool, retryAfter time.Duration) error {
+	lease := job.LeaseExpiresAt
+	now := time.Now().UTC()
+	job.UpdatedAt = now
+	job.LeaseExpiresAt = time.Time{}
+
+	switch {
+	case runErr == nil:
+		job.Status = StatusSucceeded
+		job.LastError = ""
+	case retry:
+		job.Status = StatusPending
+		job.LastError = runErr.Error()
+		job.NextAttemptAt = now.Add(retryAfter)
+	default:
+		job.Status = StatusFailed
+		job.LastError = runErr.Error()
+	}
+
+	return q.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(jobsBucket)
+
+		stored, err := checkLease(bucket, job.ID, lease)
+		if err != nil {
+			return err
+		}
+
+		if stored.Rerun {
+			log.Printf("Job %s was asked to run again during its run, scheduling it", job.ID)
+			job.Status = StatusPending
+			job.Attempts = 0
+			job.NextAttemptAt = time.Time{}
+		}
+		job.Rerun = false
+
+		return putJob(bucket, job)
+	})
+}
+
+// checkLease returns the stored job, or ErrLeaseLost unless it is still running under the lease expiring at `lease`
+func checkLease(bucket *bolt.Bucket, id string, lease time.Time) (*Job, error) {
+	stored, err := getJob(bucket, id)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil || stored.Status != StatusRunning || !stored.LeaseExpiresAt.Equal(lease) {
+		return nil, fmt.Errorf("%w: job %s was reclaimed or retried by another process", ErrLeaseLost, id)
+	}
+	return stored, nil
+}
+
+// Retry schedules a finished job to run again immediately, resetting its attempt count.
+// Running jobs are only retried when their lease expired or when `force` is set,
+// e.g. because their worker was killed.
+func (q *Queue) Retry(id string, force bool) (*Job, error) {
+	var job *Job
+
+	err := q.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(jobsBucket)
+
+		var err error
+		if job, err = getJob(bucket, id); err != nil {
+			return err
+		}
+		if job == nil {
+			return fmt.Errorf("job %s not found", id)
+		}
+		now := time.Now().UTC()
+		if job.Status == StatusRunning && !force && !job.leaseExpired(now) {
+			return fmt.Errorf("job %s is running, its lease expires at %s", id, job.LeaseExpiresAt.Local().Format(time.TimeOnly))
+		}
+
+		job.Status = StatusPending
+		job.Attempts = 0
+		job.NextAttemptAt = time.Time{}
+		job.LeaseExpiresAt = time.Time{}
+		job.Rerun = false
+		job.UpdatedAt = now
+		return putJob(bucket, job)
+	})
+
+	return job, err
+}
+
+// List returns the jobs with the given status, or all jobs if `status` is empty, oldest first
+func (q *Queue) List(status string) ([]*Job, error) {
+	var jobs []*Job
+
+	err := q.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(_, data []byte) error {
+			var job Job
+			if err := json.Unmarshal(data, &job); err != nil {
+				return err
+			}
+			if status == "" || job.Status == status {
+				jobs = append(jobs, &job)
+			}
+			return nil
+		})
+	})
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+
+	return jobs, err
+}
+
+// update runs `fn` in a read-write transaction
+func (q *Queue) update(fn func(tx *bolt.Tx) error) error {
+	db, err := q.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(fn)
+}
+
+// view runs `fn` in a read-only transaction
+func (q *Queue) view(fn func(tx *bolt.Tx) error) error {
+	db, err := q.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(fn)
+}
+
+// open opens the queue database, waiting a few seconds if another process is using it
+func (q *Queue) open() (*bolt.DB, error) {
+	db, err := bolt.Open(q.path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job queue %s: %w", q.path, err)
+	}
+	return db, nil
+}
+
+// getJob reads a job from the bucket, returning nil if it does not exist
+func getJob(bucket *bolt.Bucket, id string) (*Job, error) {
+	data := bucket.Get([]byte(id))
+	if data == nil {
+		return nil, nil
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to decode job %s: %w", id, err)
+	}
+
+	return &job, nil
+}
+
+// putJob writes a job to the bucket
+func putJob(bucket *bolt.Bucket, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job %s: %w", job.ID, err)
+	}
+
+	return bucket.Put([]byte(job.ID), data)
+}
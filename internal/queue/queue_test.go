@@ -0,0 +1,285 @@
+package queue
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// newTestQueue opens a queue in a temporary directory
+func newTestQueue(t *testing.T) *Queue {
+	t.Helper()
+
+	q, err := Open(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	return q
+}
+
+// storeJob overwrites a job in the queue, e.g. to simulate the passing of time
+func storeJob(t *testing.T, q *Queue, job *Job) {
+	t.Helper()
+
+	err := q.update(func(tx *bolt.Tx) error {
+		return putJob(tx.Bucket(jobsBucket), job)
+	})
+	if err != nil {
+		t.Fatalf("failed to store job: %v", err)
+	}
+}
+
+// getStoredJob reads a job from the queue
+func getStoredJob(t *testing.T, q *Queue, id string) *Job {
+	t.Helper()
+
+	var job *Job
+	err := q.view(func(tx *bolt.Tx) error {
+		var err error
+		job, err = getJob(tx.Bucket(jobsBucket), id)
+		return err
+	})
+	if err != nil || job == nil {
+		t.Fatalf("failed to get job %s: %v", id, err)
+	}
+	return job
+}
+
+// expireLease makes the lease of a running job expire
+func expireLease(t *testing.T, q *Queue, job *Job) {
+	t.Helper()
+
+	stored := getStoredJob(t, q, job.ID)
+	stored.LeaseExpiresAt = time.Now().UTC().Add(-time.Second)
+	storeJob(t, q, stored)
+}
+
+// TestEnqueueOneJobPerIssue checks that an issue has at most one pending or running job
+func TestEnqueueOneJobPerIssue(t *testing.T) {
+	q := newTestQueue(t)
+
+	first, created, err := q.Enqueue("acme", "sdh", 42)
+	if err != nil || !created {
+		t.Fatalf("Enqueue() = %v, %v, want a new job", created, err)
+	}
+
+	// Pending
+	if again, created, _ := q.Enqueue("acme", "sdh", 42); created || again.ID != first.ID {
+		t.Errorf("Enqueue() of a pending issue created a job")
+	}
+
+	// Running
+	job, _ := q.Claim(5)
+	if again, created, _ := q.Enqueue("acme", "sdh", 42); created || again.Status != StatusRunning {
+		t.Errorf("Enqueue() of a running issue created a job")
+	}
+
+	// Finished jobs are scheduled again
+	if err := q.Complete(job, nil, false, 0); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if again, created, _ := q.Enqueue("acme", "sdh", 42); !created || again.Status != StatusPending {
+		t.Errorf("Enqueue() of a finished issue did not schedule it again")
+	}
+
+	// Other issues get their own job
+	if _, created, _ := q.Enqueue("acme", "sdh", 43); !created {
+		t.Errorf("Enqueue() of another issue did not create a job")
+	}
+}
+
+// TestEnqueueRerun checks that a job asked to run again during its run is scheduled once it ends,
+// even if its worker renews the lease in the meantime
+func TestEnqueueRerun(t *testing.T) {
+	q := newTestQueue(t)
+	q.Enqueue("acme", "sdh", 42)
+
+	// Pending jobs are left alone, they will see the latest changes anyway
+	if job, created, _ := q.EnqueueRerun("acme", "sdh", 42); created || job.Rerun {
+		t.Errorf("EnqueueRerun() of a pending issue = %+v, %v, want the job unchanged", job, created)
+	}
+
+	job, _ := q.Claim(5)
+	again, created, err := q.EnqueueRerun("acme", "sdh", 42)
+	if err != nil || created || !again.Rerun {
+		t.Fatalf("EnqueueRerun() of a running issue = %+v, %v, %v, want the job marked to run again", again, created, err)
+	}
+
+	if err := q.Renew(job); err != nil {
+		t.Fatalf("Renew() error = %v", err)
+	}
+	if err := q.Complete(job, errors.New("boom"), false, 0); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	stored := getStoredJob(t, q, job.ID)
+	if stored.Status != StatusPending || stored.Attempts != 0 || stored.Rerun {
+		t.Errorf("job = %+v, want pending without attempts", stored)
+	}
+
+	// The new run is a regular one
+	job, _ = q.Claim(5)
+	if err := q.Complete(job, nil, false, 0); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if stored := getStoredJob(t, q, job.ID); stored.Status != StatusSucceeded {
+		t.Errorf("job status = %s, want %s", stored.Status, StatusSucceeded)
+	}
+}
+
+// TestClaim checks that pending jobs are claimed oldest first once due, and leased to the worker
+func TestClaim(t *testing.T) {
+	q := newTestQueue(t)
+
+	q.Enqueue("acme", "sdh", 1)
+	q.Enqueue("acme", "sdh", 2)
+
+	job, err := q.Claim(5)
+	if err != nil || job == nil {
+		t.Fatalf("Claim() = %v, %v, want a job", job, err)
+	}
+	if job.IssueNumber != 1 || job.Status != StatusRunning || job.Attempts != 1 {
+		t.Errorf("Claim() = %+v, want the running first attempt of issue 1", job)
+	}
+	if lease := time.Until(job.LeaseExpiresAt); lease <= 0 || lease > leaseDuration {
+		t.Errorf("lease expires in %s, want within %s", lease, leaseDuration)
+	}
+
+	// A job delayed for a retry is not due yet
+	second, _ := q.Claim(5)
+	if err := q.Complete(second, errors.New("rate limited"), true, time.Hour); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if stored := getStoredJob(t, q, second.ID); stored.Status != StatusPending || time.Until(stored.NextAttemptAt) < 59*time.Minute {
+		t.Errorf("retried job = %+v, want pending for an hour", stored)
+	}
+	if job, _ := q.Claim(5); job != nil {
+		t.Errorf("Claim() = %+v, want no job due", job)
+	}
+
+	// Nor is a running job whose lease is still valid
+	if err := q.Renew(job); err != nil {
+		t.Fatalf("Renew() error = %v", err)
+	}
+	if again, _ := q.Claim(5); again != nil {
+		t.Errorf("Claim() = %+v, want the leased job to stay with its worker", again)
+	}
+}
+
+// TestClaimExpiredLease checks that jobs abandoned by a crashed worker are reclaimed,
+// and that the previous worker can no longer renew or complete them
+func TestClaimExpiredLease(t *testing.T) {
+	q := newTestQueue(t)
+	q.Enqueue("acme", "sdh", 42)
+
+	crashed, _ := q.Claim(5)
+	expireLease(t, q, crashed)
+
+	reclaimed, err := q.Claim(5)
+	if err != nil || reclaimed == nil {
+		t.Fatalf("Claim() = %v, %v, want the abandoned job", reclaimed, err)
+	}
+	if reclaimed.ID != crashed.ID || reclaimed.Attempts != 2 {
+		t.Errorf("Claim() = %+v, want the second attempt of the abandoned job", reclaimed)
+	}
+
+	if err := q.Renew(crashed); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Renew() by the previous worker error = %v, want ErrLeaseLost", err)
+	}
+	if err := q.Complete(crashed, nil, false, 0); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Complete() by the previous worker error = %v, want ErrLeaseLost", err)
+	}
+
+	if err := q.Complete(reclaimed, nil, false, 0); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if stored := getStoredJob(t, q, reclaimed.ID); stored.Status != StatusSucceeded {
+		t.Errorf("job status = %s, want %s", stored.Status, StatusSucceeded)
+	}
+}
+
+// TestClaimExpiredLeaseMaxAttempts checks that a job abandoned on its last attempt fails instead of being reclaimed
+func TestClaimExpiredLeaseMaxAttempts(t *testing.T) {
+	q := newTestQueue(t)
+	q.Enqueue("acme", "sdh", 42)
+
+	job, _ := q.Claim(2)
+	expireLease(t, q, job)
+	job, _ = q.Claim(2)
+	expireLease(t, q, job)
+
+	if again, _ := q.Claim(2); again != nil {
+		t.Fatalf("Claim() = %+v, want no job", again)
+	}
+
+	stored := getStoredJob(t, q, job.ID)
+	if stored.Status != StatusFailed || stored.LastError == "" {
+		t.Errorf("job = %+v, want failed with an error", stored)
+	}
+}
+
+// TestRetry checks that finished and abandoned jobs can be retried, and running ones only when forced
+func TestRetry(t *testing.T) {
+	q := newTestQueue(t)
+	q.Enqueue("acme", "sdh", 42)
+
+	job, _ := q.Claim(5)
+	if _, err := q.Retry(job.ID, false); err == nil {
+		t.Errorf("Retry() of a running job error = nil, want an error")
+	}
+
+	// Forcing takes the job away from its worker
+	retried, err := q.Retry(job.ID, true)
+	if err != nil {
+		t.Fatalf("Retry() error = %v", err)
+	}
+	if retried.Status != StatusPending || retried.Attempts != 0 {
+		t.Errorf("Retry() = %+v, want a pending job without attempts", retried)
+	}
+	if err := q.Renew(job); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Renew() after a forced retry error = %v, want ErrLeaseLost", err)
+	}
+
+	// Jobs whose lease expired can be retried without forcing
+	job, _ = q.Claim(5)
+	expireLease(t, q, job)
+	if _, err := q.Retry(job.ID, false); err != nil {
+		t.Errorf("Retry() of an abandoned job error = %v", err)
+	}
+
+	// Failed jobs are due again immediately
+	job, _ = q.Claim(5)
+	q.Complete(job, errors.New("boom"), false, 0)
+	if _, err := q.Retry(job.ID, false); err != nil {
+		t.Fatalf("Retry() of a failed job error = %v", err)
+	}
+	if again, _ := q.Claim(5); again == nil || again.Attempts != 1 {
+		t.Errorf("Claim() after Retry() = %+v, want the first attempt of the job", again)
+	}
+
+	if _, err := q.Retry("acme/sdh#404", false); err == nil {
+		t.Errorf("Retry() of an unknown job error = nil, want an error")
+	}
+}
+
+// TestRetryDelay checks the exponential backoff of transient failures
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: baseRetryDelay},
+		{attempts: 2, want: 2 * baseRetryDelay},
+		{attempts: 3, want: 4 * baseRetryDelay},
+		{attempts: 10, want: maxRetryDelay},
+		{attempts: 100, want: maxRetryDelay},
+	}
+
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
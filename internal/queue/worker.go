@@ -0,0 +1,214 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"sdh-agent/pkg/utils"
+
+	"github.com/google/go-github/v63/github"
+)
+
+const (
+	// pollInterval is how often idle workers look for jobs that became due
+	pollInterval = 10 * time.Second
+	// leaseRenewInterval is how often workers renew the lease of their running job, well within `leaseDuration`
+	leaseRenewInterval = time.Minute
+
+	// Retries of transient failures are delayed by baseRetryDelay * 2^(attempt-1), up to maxRetryDelay
+	baseRetryDelay = time.Minute
+	maxRetryDelay  = 30 * time.Minute
+)
+
+// Handler runs a job, returning an error if it failed
+type Handler func(ctx context.Context, job *Job) error
+
+// WorkOptions configures how jobs are processed
+type WorkOptions struct {
+	// Workers is the number of jobs processed in parallel
+	Workers int
+	// MaxAttempts is the number of times a job is attempted before it is marked as failed
+	MaxAttempts int
+	// ExitWhenIdle stops the workers once no pending job is due instead of waiting for new jobs
+	ExitWhenIdle bool
+}
+
+// Work processes jobs with `handler` until `ctx` is cancelled, or until the queue is idle if `opts.ExitWhenIdle` is set
+func (q *Queue) Work(ctx context.Context, opts WorkOptions, handler Handler) {
+	var wg sync.WaitGroup
+	for w := 0; w < max(opts.Workers, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx, opts, handler)
+		}()
+	}
+	wg.Wait()
+}
+
+// work is the loop of a single worker
+func (q *Queue) work(ctx context.Context, opts WorkOptions, handler Handler) {
+	for ctx.Err() == nil {
+		job, err := q.Claim(opts.MaxAttempts)
+		if err != nil {
+			log.Printf("Failed to claim job: %v", err)
+		}
+
+		if job == nil {
+			if opts.ExitWhenIdle && err == nil {
+				return
+			}
+
+			// Wait for a new job or for a delayed retry to become due
+			select {
+			case <-ctx.Done():
+			case <-q.wake:
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+
+		q.runJob(ctx, opts, handler, job)
+	}
+}
+
+// runJob runs a claimed job and records its outcome
+func (q *Queue) runJob(ctx context.Context, opts WorkOptions, handler Handler, job *Job) {
+	log.Printf("Running job %s (attempt %d/%d)", job.ID, job.Attempts, opts.MaxAttempts)
+
+	// Keep the job leased while it runs, and stop it if another process took it over
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	stopRenewing := q.renewLease(jobCtx, cancel, job)
+	runErr := handler(jobCtx, job)
+	stopRenewing()
+	cancel(nil)
+
+	var err error
+	switch {
+	case errors.Is(context.Cause(jobCtx), ErrLeaseLost):
+		// The job was reclaimed or retried by another process, which now owns its outcome
+		log.Printf("Job %s was taken over by another process", job.ID)
+		return
+	case runErr == nil:
+		log.Printf("Job %s succeeded", job.ID)
+		err = q.Complete(job, nil, false, 0)
+	case ctx.Err() != nil:
+		// The worker is shutting down: put the job back without counting the attempt
+		log.Printf("Job %s interrupted, it will run again on restart", job.ID)
+		job.Attempts--
+		err = q.Complete(job, runErr, true, 0)
+	case IsTransient(runErr) && job.Attempts < opts.MaxAttempts:
+		// Back off, but never retry before the time the API asked for
+		delay := retryDelay(job.Attempts)
+		if retryAfter, ok := requestedRetryAfter(runErr); ok {
+			delay = max(delay, retryAfter)
+		}
+		log.Printf("Job %s failed with a transient error, retrying in %s: %v", job.ID, delay, runErr)
+		err = q.Complete(job, runErr, true, delay)
+	default:
+		log.Printf("Job %s failed: %v", job.ID, runErr)
+		err = q.Complete(job, runErr, false, 0)
+	}
+
+	if err != nil {
+		log.Printf("Failed to record outcome of job %s: %v", job.ID, err)
+	}
+}
+
+// renewLease renews the lease of a running job every `leaseRenewInterval` until the returned function
+// is called, cancelling the job with `cancel` if its lease was lost
+func (q *Queue) renewLease(ctx context.Context, cancel context.CancelCauseFunc, job *Job) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(leaseRenewInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			err := q.Renew(job)
+			if errors.Is(err, ErrLeaseLost) {
+				log.Printf("Stopping job %s: %v", job.ID, err)
+				cancel(err)
+				return
+			}
+			if err != nil {
+				log.Printf("Failed to renew the lease of job %s: %v", job.ID, err)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// retryDelay returns the delay before the next attempt of a job that failed `attempts` times
+func retryDelay(attempts int) time.Duration {
+	delay := baseRetryDelay << max(attempts-1, 0)
+	if delay <= 0 || delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+// requestedRetryAfter returns the delay a GitHub or LLM API asked to wait before retrying a failed request
+func requestedRetryAfter(err error) (time.Duration, bool) {
+	var rateLimitErr *github.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return max(time.Until(rateLimitErr.Rate.Reset.Time), 0), true
+	}
+
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) && abuseErr.RetryAfter != nil {
+		return *abuseErr.RetryAfter, true
+	}
+
+	return utils.RetryAfter(err)
+}
+
+// IsTransient reports whether an error is likely to go away by retrying later,
+// such as rate limits, server errors or network failures. Cancellations and deadlines are not,
+// even when reported by a network call.
+func IsTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var rateLimitErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &rateLimitErr) || errors.As(err, &abuseErr) {
+		return true
+	}
+
+	var responseErr *github.ErrorResponse
+	if errors.As(err, &responseErr) && responseErr.Response != nil {
+		return responseErr.Response.StatusCode >= 500
+	}
+
+	// LLM API failures
+	var httpErr *utils.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,90 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"sdh-agent/pkg/utils"
+
+	"github.com/google/go-github/v63/github"
+)
+
+// TestIsTransient checks which job errors are retried later
+func TestIsTransient(t *testing.T) {
+	githubError := func(status int) error {
+		return &github.ErrorResponse{Response: &http.Response{StatusCode: status}}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "GitHub rate limit", err: &github.RateLimitError{}, want: true},
+		{name: "GitHub secondary rate limit", err: fmt.Errorf("failed to search issues: %w", &github.AbuseRateLimitError{}), want: true},
+		{name: "GitHub server error", err: githubError(http.StatusBadGateway), want: true},
+		{name: "GitHub not found", err: githubError(http.StatusNotFound), want: false},
+		{name: "LLM rate limit", err: fmt.Errorf("max retries exceeded: %w", &utils.HTTPError{StatusCode: http.StatusTooManyRequests}), want: true},
+		{name: "LLM overloaded", err: &utils.HTTPError{StatusCode: 529}, want: true},
+		{name: "LLM bad request", err: &utils.HTTPError{StatusCode: http.StatusBadRequest}, want: false},
+		{name: "connection refused", err: fmt.Errorf("failed to send request: %w", &url.Error{Op: "Post", URL: "https://api.example.com", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}), want: true},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, want: false},
+		{name: "request deadline exceeded", err: fmt.Errorf("failed to send request: %w", &url.Error{Op: "Post", URL: "https://api.example.com", Err: context.DeadlineExceeded}), want: false},
+		{name: "cancelled", err: fmt.Errorf("rate limiter wait error: %w", context.Canceled), want: false},
+		{name: "other error", err: errors.New("failed to summarize issue content: invalid response"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.want {
+				t.Errorf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRequestedRetryAfter checks that the retry delay asked by GitHub and LLM APIs is found in job errors
+func TestRequestedRetryAfter(t *testing.T) {
+	retryAfter := 10 * time.Minute
+
+	tests := []struct {
+		name     string
+		err      error
+		min, max time.Duration
+		wantOK   bool
+	}{
+		{
+			name:   "GitHub rate limit reset",
+			err:    &github.RateLimitError{Rate: github.Rate{Reset: github.Timestamp{Time: time.Now().Add(time.Hour)}}},
+			min:    59 * time.Minute,
+			max:    time.Hour,
+			wantOK: true,
+		},
+		{name: "GitHub secondary rate limit", err: &github.AbuseRateLimitError{RetryAfter: &retryAfter}, min: retryAfter, max: retryAfter, wantOK: true},
+		{name: "GitHub secondary rate limit without delay", err: &github.AbuseRateLimitError{}, wantOK: false},
+		{
+			name:   "LLM retry-after header",
+			err:    fmt.Errorf("API asked to retry in 1h0m0s, giving up: %w", &utils.HTTPError{StatusCode: 429, Header: http.Header{"Retry-After": {"3600"}}}),
+			min:    time.Hour,
+			max:    time.Hour,
+			wantOK: true,
+		},
+		{name: "LLM error without header", err: &utils.HTTPError{StatusCode: 529}, wantOK: false},
+		{name: "other error", err: errors.New("boom"), wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := requestedRetryAfter(tt.err)
+			if ok != tt.wantOK || got < tt.min || got > tt.max {
+				t.Errorf("requestedRetryAfter() = %s, %v, want within [%s, %s], %v", got, ok, tt.min, tt.max, tt.wantOK)
+			}
+		})
+	}
+}
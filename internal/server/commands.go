@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v63/github"
+)
+
+// commandPrefix starts the slash commands recognized in issue comments
+const commandPrefix = "/sdh-agent"
+
+// Slash commands
+const (
+	// commandAnalyze triggers the analysis of the issue
+	commandAnalyze = "analyze"
+	// commandRefresh re-runs the analysis, updating the existing report, even if an analysis is running
+	commandRefresh = "refresh"
+)
+
+// Reactions used to acknowledge slash commands
+const (
+	reactionAccepted     = "eyes"
+	reactionUnauthorized = "-1"
+	reactionUnknown      = "confused"
+)
+
+// trustedAssociations are the author associations allowed to run commands when no allowlist is configured
+var trustedAssociations = map[string]bool{
+	"OWNER":        true,
+	"MEMBER":       true,
+	"COLLABORATOR": true,
+}
+
+// handleIssueCommentEvent runs the slash command contained in a new issue comment, if any
+func (s *Server) handleIssueCommentEvent(w http.ResponseWriter, r *http.Request, event *github.IssueCommentEvent) {
+	comment := event.GetComment()
+	issue := event.GetIssue()
+
+	if event.GetAction() != "created" || !s.isConfiguredRepo(event.GetRepo()) || issue.IsPullRequest() ||
+		comment.GetUser().GetType() == "Bot" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	command, ok := parseCommand(comment.GetBody())
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	ctx := r.Context()
+	user := comment.GetUser().GetLogin()
+	log.Printf("Received command %q from %s on issue #%d", command, user, issue.GetNumber())
+
+	if command != commandAnalyze && command != commandRefresh {
+		s.react(ctx, comment, reactionUnknown)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	authorized, err := s.isAuthorized(ctx, user, comment.GetAuthorAssociation())
+	if err != nil {
+		log.Printf("Failed to authorize %s: %v", user, err)
+		http.Error(w, "failed to authorize commenter", http.StatusInternalServerError)
+		return
+	}
+	if !authorized {
+		log.Printf("Ignoring command from unauthorized user %s", user)
+		s.react(ctx, comment, reactionUnauthorized)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Acknowledge the command before the analysis starts
+	s.react(ctx, comment, reactionAccepted)
+
+	// A running analysis may miss changes made since it started, so refresh runs it again afterwards
+	if err := s.enqueue(issue.GetNumber(), command == commandRefresh); err != nil {
+		log.Printf("Failed to queue issue #%d: %v", issue.GetNumber(), err)
+		http.Error(w, "failed to queue job", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// parseCommand returns the command of the first line of `body` starting with the command prefix
+func parseCommand(body string) (string, bool) {
+	for _, line := range strings.Split(body, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != commandPrefix {
+			continue
+		}
+
+		if len(fields) == 1 {
+			return "", true
+		}
+		return strings.ToLower(fields[1]), true
+	}
+
+	return "", false
+}
+
+// isAuthorized reports whether a user may run slash commands, based on the configured
+// allowlists or, when none is configured, on the user's association with the repository
+func (s *Server) isAuthorized(ctx context.Context, user, association string) (bool, error) {
+	cfg := s.config
+	if len(cfg.SlashCommandUsers) == 0 && len(cfg.SlashCommandOrgs) == 0 && len(cfg.SlashCommandTeams) == 0 {
+		return trustedAssociations[association], nil
+	}
+
+	for _, allowed := range cfg.SlashCommandUsers {
+		if strings.EqualFold(allowed, user) {
+			return true, nil
+		}
+	}
+
+	for _, org := range cfg.SlashCommandOrgs {
+		member, err := s.agent.GitHubClient().IsOrgMember(ctx, org, user)
+		if err != nil || member {
+			return member, err
+		}
+	}
+
+	for _, team := range cfg.SlashCommandTeams {
+		org, slug, _ := strings.Cut(team, "/")
+		member, err := s.agent.GitHubClient().IsTeamMember(ctx, org, slug, user)
+		if err != nil || member {
+			return member, err
+		}
+	}
+
+	return false, nil
+}
+
+// react adds a reaction to a comment, logging failures since reactions are only informative
+func (s *Server) react(ctx context.Context, comment *github.IssueComment, reaction string) {
+	err := s.agent.GitHubClient().AddCommentReaction(ctx, s.config.GitHubRepoOwner, s.config.GitHubRepoName, comment.GetID(), reaction)
+	if err != nil {
+		log.Printf("Failed to react to comment %d: %v", comment.GetID(), err)
+	}
+}
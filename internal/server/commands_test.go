@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"sdh-agent/internal/config"
+)
+
+// TestParseCommand checks that slash commands are found on any line of a comment
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantCmd bool
+	}{
+		{name: "analyze", body: "/sdh-agent analyze", want: "analyze", wantCmd: true},
+		{name: "refresh with arguments", body: "/sdh-agent refresh now please", want: "refresh", wantCmd: true},
+		{name: "case insensitive command", body: "/sdh-agent ReFresh", want: "refresh", wantCmd: true},
+		{name: "surrounding whitespace", body: "  /sdh-agent   analyze  ", want: "analyze", wantCmd: true},
+		{name: "later line", body: "Thanks for the report.\n/sdh-agent analyze\n", want: "analyze", wantCmd: true},
+		{name: "first command wins", body: "/sdh-agent refresh\n/sdh-agent analyze", want: "refresh", wantCmd: true},
+		{name: "prefix without command", body: "/sdh-agent", want: "", wantCmd: true},
+		{name: "unknown command", body: "/sdh-agent deploy", want: "deploy", wantCmd: true},
+		{name: "mid-line mention", body: "please run /sdh-agent analyze", wantCmd: false},
+		{name: "other prefix", body: "/sdh-agents analyze", wantCmd: false},
+		{name: "case sensitive prefix", body: "/SDH-AGENT analyze", wantCmd: false},
+		{name: "empty", body: "", wantCmd: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseCommand(tt.body)
+			if got != tt.want || ok != tt.wantCmd {
+				t.Errorf("parseCommand(%q) = %q, %v, want %q, %v", tt.body, got, ok, tt.want, tt.wantCmd)
+			}
+		})
+	}
+}
+
+// TestIsAuthorized checks the authorization of commenters by association and user allowlist
+func TestIsAuthorized(t *testing.T) {
+	tests := []struct {
+		name        string
+		users       []string
+		user        string
+		association string
+		want        bool
+	}{
+		{name: "owner", user: "alice", association: "OWNER", want: true},
+		{name: "member", user: "alice", association: "MEMBER", want: true},
+		{name: "collaborator", user: "alice", association: "COLLABORATOR", want: true},
+		{name: "contributor", user: "alice", association: "CONTRIBUTOR", want: false},
+		{name: "first time contributor", user: "alice", association: "FIRST_TIME_CONTRIBUTOR", want: false},
+		{name: "no association", user: "alice", association: "NONE", want: false},
+		{name: "allowlisted user", users: []string{"bob", "alice"}, user: "alice", association: "NONE", want: true},
+		{name: "allowlisted user in another case", users: []string{"Alice"}, user: "alice", association: "NONE", want: true},
+		{name: "allowlist overrides associations", users: []string{"bob"}, user: "alice", association: "OWNER", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{config: config.Configuration{SlashCommandUsers: tt.users}}
+
+			got, err := s.isAuthorized(context.Background(), tt.user, tt.association)
+			if err != nil {
+				t.Fatalf("isAuthorized() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("isAuthorized(%q, %q) = %v, want %v", tt.user, tt.association, got, tt.want)
+			}
+		})
+	}
+}
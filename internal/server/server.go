@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"sdh-agent/internal/agent"
+	"sdh-agent/internal/config"
+	"sdh-agent/internal/queue"
+)
+
+// shutdownTimeout is how long in-flight HTTP requests get to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// Server receives GitHub webhooks and runs the SDH agent on matching issues
+type Server struct {
+	config config.Configuration
+	agent  *agent.SDHAgent
+	// labels holds the labels an issue must have one of to be analyzed, empty means all issues
+	labels map[string]bool
+	// jobs persists the analyses triggered by webhooks until they are done
+	jobs *queue.Queue
+}
+
+// New creates a new webhook server processing the jobs of `jobs`
+func New(cfg config.Configuration, sdhAgent *agent.SDHAgent, jobs *queue.Queue) (*Server, error) {
+	if cfg.WebhookSecret == "" {
+		return nil, fmt.Errorf("WEBHOOK_SECRET environment variable not set")
+	}
+
+	labels := make(map[string]bool, len(cfg.WebhookLabels))
+	for _, label := range cfg.WebhookLabels {
+		labels[label] = true
+	}
+
+	return &Server{
+		config: cfg,
+		agent:  sdhAgent,
+		labels: labels,
+		jobs:   jobs,
+	}, nil
+}
+
+// Run serves webhooks on the configured address and processes jobs until `ctx` is cancelled
+func (s *Server) Run(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /webhook", s.handleWebhook)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	httpServer := &http.Server{
+		Addr:              s.config.ServerAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// Process jobs in the background. Jobs interrupted by a crash are claimed again once their lease expires.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.jobs.Work(ctx, queue.WorkOptions{
+			Workers:     s.config.WebhookWorkers,
+			MaxAttempts: s.config.QueueMaxAttempts,
+		}, s.runJob)
+	}()
+
+	// Stop accepting requests once the context is cancelled
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Listening for GitHub webhooks on %s", s.config.ServerAddr)
+	err := httpServer.ListenAndServe()
+	wg.Wait()
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// enqueue schedules the analysis of an issue, ignoring issues that already have a pending job.
+// A running job is left alone too, unless `rerun` is set: it then runs again once done.
+func (s *Server) enqueue(issueNumber int, rerun bool) error {
+	enqueue := s.jobs.Enqueue
+	if rerun {
+		enqueue = s.jobs.EnqueueRerun
+	}
+
+	job, created, err := enqueue(s.config.GitHubRepoOwner, s.config.GitHubRepoName, issueNumber)
+	if err != nil {
+		return err
+	}
+
+	if created {
+		log.Printf("Queued job %s", job.ID)
+	} else if job.Rerun {
+		log.Printf("Job %s is running, it will run again once done", job.ID)
+	} else {
+		log.Printf("Job %s is already %s", job.ID, job.Status)
+	}
+	return nil
+}
+
+// runJob analyzes the issue of a job and posts its report
+func (s *Server) runJob(ctx context.Context, job *queue.Job) error {
+	return s.agent.AnalyzeAndPublish(ctx, job.IssueNumber)
+}
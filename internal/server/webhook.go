@@ -0,0 +1,111 @@
+package server
+
+import (
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v63/github"
+)
+
+// maxPayloadSize limits the size of webhook payloads (GitHub caps them at 25 MB)
+const maxPayloadSize = 25 << 20
+
+// handleWebhook verifies and handles a GitHub webhook delivery
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxPayloadSize)
+
+	// Only accept payloads signed with the SHA-256 HMAC of the webhook secret
+	signature := r.Header.Get(github.SHA256SignatureHeader)
+	if signature == "" {
+		http.Error(w, "missing "+github.SHA256SignatureHeader+" header", http.StatusUnauthorized)
+		return
+	}
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, "invalid Content-Type", http.StatusBadRequest)
+		return
+	}
+
+	payload, err := github.ValidatePayloadFromBody(contentType, r.Body, signature, []byte(s.config.WebhookSecret))
+	if err != nil {
+		log.Printf("Rejected webhook delivery %s: %v", github.DeliveryID(r), err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	event, err := github.ParseWebHook(github.WebHookType(r), payload)
+	if err != nil {
+		// Acknowledge events we do not handle so that GitHub does not report failures
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	switch event := event.(type) {
+	case *github.IssuesEvent:
+		s.handleIssuesEvent(w, event)
+	case *github.IssueCommentEvent:
+		s.handleIssueCommentEvent(w, r, event)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleIssuesEvent queues the analysis of newly opened or labelled issues that match the configured labels
+func (s *Server) handleIssuesEvent(w http.ResponseWriter, event *github.IssuesEvent) {
+	issue := event.GetIssue()
+
+	if !s.isConfiguredRepo(event.GetRepo()) || issue.IsPullRequest() {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	switch event.GetAction() {
+	case "opened":
+		if !s.matchesLabels(issue.Labels) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	case "labeled":
+		// Only react to the label that makes the issue match, not to any later label
+		if len(s.labels) == 0 || !s.labels[event.GetLabel().GetName()] {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err := s.enqueue(issue.GetNumber(), false); err != nil {
+		log.Printf("Failed to queue issue #%d: %v", issue.GetNumber(), err)
+		http.Error(w, "failed to queue job", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// isConfiguredRepo reports whether the event comes from the repository the agent is configured for.
+// GitHub owner and repository names are case-insensitive.
+func (s *Server) isConfiguredRepo(repo *github.Repository) bool {
+	return strings.EqualFold(repo.GetOwner().GetLogin(), s.config.GitHubRepoOwner) &&
+		strings.EqualFold(repo.GetName(), s.config.GitHubRepoName)
+}
+
+// matchesLabels reports whether an issue has one of the configured labels, or true if no labels are configured
+func (s *Server) matchesLabels(labels []*github.Label) bool {
+	if len(s.labels) == 0 {
+		return true
+	}
+
+	for _, label := range labels {
+		if s.labels[label.GetName()] {
+			return true
+		}
+	}
+
+	return false
+}
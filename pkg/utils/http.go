@@ -2,12 +2,84 @@ package utils
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/rand"
 	"net/http"
+	"slices"
+	"strconv"
 	"time"
 )
 
+// MaxRetryAfter is the longest Retry-After delay that API clients wait before retrying a request.
+// Requests asked to wait longer fail instead, leaving the retry to the caller (e.g. the job queue).
+const MaxRetryAfter = 5 * time.Minute
+
+// HTTPError is returned for API responses with a non-success status code
+type HTTPError struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+}
+
+// Error implements the error interface
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("API returned non-success status code %d: %s", e.StatusCode, e.Body)
+}
+
+// RetryAfter returns the delay requested by the Retry-After header, given in seconds or as an HTTP date
+func (e *HTTPError) RetryAfter() (time.Duration, bool) {
+	value := e.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
+
+// RetryAfter returns the delay requested by the Retry-After header of an *HTTPError in the error chain,
+// e.g. so that a job rescheduled after an API gave up waiting does not retry too early
+func RetryAfter(err error) (time.Duration, bool) {
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		return 0, false
+	}
+	return httpErr.RetryAfter()
+}
+
+// IsRetryableStatus reports whether an error is an *HTTPError with one of the given status codes
+func IsRetryableStatus(err error, statusCodes ...int) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && slices.Contains(statusCodes, httpErr.StatusCode)
+}
+
+// RetryDelay returns the delay before retrying a failed request, honoring the Retry-After header if present,
+// and false if the API asks to wait longer than MaxRetryAfter. Without the header, the delay backs off
+// exponentially from `baseBackoff`.
+func RetryDelay(err error, baseBackoff time.Duration, attempt int) (time.Duration, bool) {
+	if delay, ok := RetryAfter(err); ok {
+		return delay, delay <= MaxRetryAfter
+	}
+	return Backoff(baseBackoff, attempt), true
+}
+
+// Backoff returns the delay before retry number `attempt` (from 0): baseBackoff * 2^attempt with ±20% jitter
+func Backoff(baseBackoff time.Duration, attempt int) time.Duration {
+	backoff := float64(baseBackoff) * math.Pow(2, float64(attempt))
+	return time.Duration(backoff * (0.8 + 0.4*rand.Float64()))
+}
+
 // CreateDefaultHTTPClient creates an HTTP client with a default timeout
 func CreateDefaultHTTPClient() *http.Client {
 	return CreateHTTPClient(
@@ -23,8 +95,8 @@ func CreateHTTPClient(timeout time.Duration) *http.Client {
 }
 
 // CreateRequest creates an HTTP request with JSON body and headers
-func CreateRequest(method, url string, jsonData []byte, headers map[string]string) (*http.Request, error) {
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(jsonData))
+func CreateRequest(ctx context.Context, method, url string, jsonData []byte, headers map[string]string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -49,8 +121,9 @@ func ReadResponse(resp *http.Response) ([]byte, error) {
 	return respBody, nil
 }
 
-// SendJSONRequest sends a JSON request to an API and unmarshals the response
-func SendJSONRequest(client *http.Client, method, url string, requestBody interface{}, responseBody interface{}, headers map[string]string) error {
+// SendJSONRequest sends a JSON request to an API and unmarshals the response.
+// Responses with a non-success status code are returned as an *HTTPError.
+func SendJSONRequest(ctx context.Context, client *http.Client, method, url string, requestBody interface{}, responseBody interface{}, headers map[string]string) error {
 	// Marshal request body to JSON
 	jsonData, err := MarshalJSON(requestBody)
 	if err != nil {
@@ -58,7 +131,7 @@ func SendJSONRequest(client *http.Client, method, url string, requestBody interf
 	}
 
 	// Create request with headers
-	req, err := CreateRequest(method, url, jsonData, headers)
+	req, err := CreateRequest(ctx, method, url, jsonData, headers)
 	if err != nil {
 		return err
 	}
@@ -78,7 +151,7 @@ func SendJSONRequest(client *http.Client, method, url string, requestBody interf
 
 	// Check response status
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("API returned non-success status code %d: %s", resp.StatusCode, string(respBody))
+		return &HTTPError{StatusCode: resp.StatusCode, Header: resp.Header, Body: string(respBody)}
 	}
 
 	// Unmarshal response if a response struct is provided
@@ -90,3 +163,38 @@ func SendJSONRequest(client *http.Client, method, url string, requestBody interf
 
 	return nil
 }
+
+// SendStreamingRequest sends a JSON request to an API and returns the response body to be read as it
+// arrives, which the caller must close. Responses with a non-success status code are returned as an *HTTPError.
+func SendStreamingRequest(ctx context.Context, client *http.Client, method, url string, requestBody interface{}, headers map[string]string) (io.ReadCloser, error) {
+	// Marshal request body to JSON
+	jsonData, err := MarshalJSON(requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create request with headers
+	req, err := CreateRequest(ctx, method, url, jsonData, headers)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	// Send request
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	// Check response status, the body of errors is small and read at once
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		respBody, err := ReadResponse(resp)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Header: resp.Header, Body: string(respBody)}
+	}
+
+	return resp.Body, nil
+}
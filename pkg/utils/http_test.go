@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestIsRetryableStatus checks that only HTTP errors with one of the given status codes are retried
+func TestIsRetryableStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "listed status", err: &HTTPError{StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "wrapped listed status", err: fmt.Errorf("failed: %w", &HTTPError{StatusCode: 529}), want: true},
+		{name: "other status", err: &HTTPError{StatusCode: http.StatusBadRequest}, want: false},
+		{name: "not an HTTP error", err: fmt.Errorf("connection reset"), want: false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRetryableStatus(tt.err, http.StatusTooManyRequests, 529); got != tt.want {
+			t.Errorf("%s: IsRetryableStatus() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestRetryDelay checks that the Retry-After header takes precedence over the exponential backoff
+func TestRetryDelay(t *testing.T) {
+	retryAfter := func(value string) error {
+		return &HTTPError{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {value}}}
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		attempt  int
+		min, max time.Duration
+		wantOK   bool
+	}{
+		{name: "retry-after seconds", err: retryAfter("30"), attempt: 3, min: 30 * time.Second, max: 30 * time.Second, wantOK: true},
+		{name: "retry-after too long", err: retryAfter("3600"), min: time.Hour, max: time.Hour, wantOK: false},
+		{name: "invalid retry-after", err: retryAfter("soon"), attempt: 0, min: 8 * time.Second, max: 12 * time.Second, wantOK: true},
+		{name: "first backoff", err: &HTTPError{StatusCode: 529}, attempt: 0, min: 8 * time.Second, max: 12 * time.Second, wantOK: true},
+		{name: "third backoff", err: &HTTPError{StatusCode: 529}, attempt: 2, min: 32 * time.Second, max: 48 * time.Second, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		delay, ok := RetryDelay(tt.err, 10*time.Second, tt.attempt)
+		if delay < tt.min || delay > tt.max || ok != tt.wantOK {
+			t.Errorf("%s: RetryDelay() = %s, %v, want within [%s, %s], %v", tt.name, delay, ok, tt.min, tt.max, tt.wantOK)
+		}
+	}
+}
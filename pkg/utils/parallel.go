@@ -0,0 +1,32 @@
+package utils
+
+import "sync"
+
+// ParallelMap applies `fn` to every item using at most `workers` goroutines
+// and returns the results in the same order as the input items
+func ParallelMap[T, R any](items []T, workers int, fn func(item T) R) []R {
+	results := make([]R, len(items))
+	if workers < 1 {
+		workers = 1
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(items)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = fn(items[i])
+			}
+		}()
+	}
+
+	for i := range items {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxEventLineSize bounds the length of a line of an event stream
+const maxEventLineSize = 1024 * 1024
+
+// ReadServerSentEvents reads a text/event-stream, calling `handle` with the type and data of each event
+// until the stream ends or `handle` returns an error. Events without a type have the "message" type.
+// As the event stream specification requires, an event not ended by a blank line when the stream ends is
+// discarded, since the stream may have been cut in the middle of it.
+func ReadServerSentEvents(r io.Reader, handle func(event, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEventLineSize)
+
+	event := ""
+	var data []string
+
+	dispatch := func() error {
+		defer func() { event, data = "", nil }()
+		if len(data) == 0 {
+			return nil
+		}
+		if event == "" {
+			event = "message"
+		}
+		return handle(event, strings.Join(data, "\n"))
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// A blank line ends the current event
+		if line == "" {
+			if err := dispatch(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Lines starting with a colon are comments, e.g. keep-alives
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read event stream: %w", err)
+	}
+
+	return nil
+}
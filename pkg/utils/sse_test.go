@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestReadServerSentEvents checks the parsing of event streams read from memory
+func TestReadServerSentEvents(t *testing.T) {
+	type event struct{ Event, Data string }
+
+	tests := []struct {
+		name   string
+		stream string
+		want   []event
+	}{
+		{
+			name:   "typed events",
+			stream: "event: ping\ndata: {}\n\nevent: delta\ndata: {\"text\":\"hi\"}\n\n",
+			want:   []event{{"ping", "{}"}, {"delta", `{"text":"hi"}`}},
+		},
+		{
+			name:   "untyped event",
+			stream: "data: hello\n\n",
+			want:   []event{{"message", "hello"}},
+		},
+		{
+			name:   "multi-line data",
+			stream: "event: text\ndata: first\ndata: second\n\n",
+			want:   []event{{"text", "first\nsecond"}},
+		},
+		{
+			name:   "comments and fields without data",
+			stream: ": keep-alive\n\nevent: ignored\n\nid: 1\nretry: 100\ndata: kept\n\n",
+			want:   []event{{"message", "kept"}},
+		},
+		{
+			name:   "no space after colon",
+			stream: "event:delta\ndata:{}\n\n",
+			want:   []event{{"delta", "{}"}},
+		},
+		{
+			name:   "incomplete final event is discarded",
+			stream: "event: a\ndata: 1\n\nevent: b\ndata: 2\n",
+			want:   []event{{"a", "1"}},
+		},
+		{
+			name:   "stream cut in the middle of a line",
+			stream: "event: a\ndata: 1\n\nevent: b\ndata: {\"partial",
+			want:   []event{{"a", "1"}},
+		},
+		{
+			name:   "empty stream",
+			stream: "",
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []event
+			err := ReadServerSentEvents(strings.NewReader(tt.stream), func(name, data string) error {
+				got = append(got, event{name, data})
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ReadServerSentEvents() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestReadServerSentEventsHandlerError checks that reading stops at the first handler error
+func TestReadServerSentEventsHandlerError(t *testing.T) {
+	stop := errors.New("stop")
+	calls := 0
+
+	err := ReadServerSentEvents(strings.NewReader("data: 1\n\ndata: 2\n\n"), func(_, _ string) error {
+		calls++
+		return stop
+	})
+
+	if !errors.Is(err, stop) {
+		t.Errorf("ReadServerSentEvents() error = %v, want %v", err, stop)
+	}
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"context"
+	"time"
+)
+
+// Sleep pauses for the given duration, returning early with the context error if `ctx` is done first
+func Sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,25 @@
+package utils
+
+import "math"
+
+const (
+	avgCharsPerToken = 4.0 // Average characters per token for English text
+	baseTokens       = 3   // Base tokens per message (conservative estimate)
+)
+
+// EstimateTokenCount estimates the number of tokens in a slice of strings, e.g. for rate limiting
+// or for providers that do not report usage
+func EstimateTokenCount(texts []string) int {
+	totalTokens := 0
+
+	for _, text := range texts {
+		if text == "" {
+			continue
+		}
+
+		// Add base tokens plus character-based estimation, rounding up for a conservative estimate
+		totalTokens += baseTokens + int(math.Ceil(float64(len(text))/avgCharsPerToken))
+	}
+
+	return totalTokens
+}